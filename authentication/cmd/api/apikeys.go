@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// last_used_at is only written again once it's older than this, not on every request
+const apiKeyTouchInterval = time.Minute
+
+var errAPIKeyRejected = errors.New("api key rejected")
+
+// checkAPIKey returns the issued key matching secret when it may be used against the service scope
+func (app *Config) checkAPIKey(secret, scope string) (*data.APIKey, error) {
+	apiKey, err := app.Models.APIKey.GetByKey(secret)
+	if err != nil {
+		if !errors.Is(err, data.ErrAPIKeyNotFound) {
+			log.Printf("checkAPIKey: %s", err)
+		}
+		return nil, errAPIKeyRejected
+	}
+
+	now := time.Now()
+	if !apiKey.Allows(scope, now) {
+		return nil, errAPIKeyRejected
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		go func(id int) {
+			if err := app.Models.APIKey.Touch(id, now); err != nil {
+				log.Printf("Can't update last use of api key %d: %s", id, err)
+			}
+		}(apiKey.ID)
+	}
+
+	return apiKey, nil
+}
+
+// bindAPIKeyID reads the :id of the key from the path
+func bindAPIKeyID(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "Invalid api key id",
+		})
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (app *Config) ListAPIKeys(ctx *gin.Context) {
+	keys, err := app.Models.APIKey.All()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, keys)
+}
+
+func (app *Config) CreateAPIKey(ctx *gin.Context) {
+	var requestPayload struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if len(requestPayload.Scopes) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "At least one scope is required",
+		})
+		return
+	}
+
+	for _, scope := range requestPayload.Scopes {
+		if !data.ValidScope(scope) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": fmt.Sprintf("Unknown scope %s, must be %s, %s or %s", scope, data.ScopeAuthentication, data.ScopeEnrollment, data.ScopeMail),
+			})
+			return
+		}
+	}
+
+	if requestPayload.ExpiresAt != nil && !requestPayload.ExpiresAt.After(time.Now()) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "expires_at must be in the future",
+		})
+		return
+	}
+
+	apiKey, secret, err := app.Models.APIKey.Insert(data.APIKey{
+		Name:      requestPayload.Name,
+		Scopes:    requestPayload.Scopes,
+		ExpiresAt: requestPayload.ExpiresAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Store the key now, it can't be shown again",
+		"key":     secret,
+		"api_key": apiKey,
+	})
+}
+
+func (app *Config) RevokeAPIKey(ctx *gin.Context) {
+	id, ok := bindAPIKeyID(ctx)
+	if !ok {
+		return
+	}
+
+	err := app.Models.APIKey.Revoke(id)
+	if err != nil {
+		if errors.Is(err, data.ErrAPIKeyNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Api key not found or already revoked"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Api key %d revoked", id),
+	})
+}
+
+func (app *Config) RotateAPIKey(ctx *gin.Context) {
+	id, ok := bindAPIKeyID(ctx)
+	if !ok {
+		return
+	}
+
+	apiKey, secret, err := app.Models.APIKey.Rotate(id)
+	if err != nil {
+		if errors.Is(err, data.ErrAPIKeyNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Api key not found or revoked"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Store the key now, it can't be shown again",
+		"key":     secret,
+		"api_key": apiKey,
+	})
+}
+
+// the services cache the keys they verified, so they call verify about once a minute per
+// key, the limit only slows down whoever tries keys at random
+var verifyLimitByIP = newRateLimiter(120, time.Minute)
+
+// VerifyAPIKey lets the other services check the API keys their clients send
+func (app *Config) VerifyAPIKey(ctx *gin.Context) {
+	var requestPayload struct {
+		Key   string `json:"key" binding:"required"`
+		Scope string `json:"scope" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !verifyLimitByIP.Allow(ctx.ClientIP()) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "true",
+			"message": "Too many verifications, try again later",
+		})
+		return
+	}
+
+	apiKey, err := app.checkAPIKey(requestPayload.Key, requestPayload.Scope)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "true",
+			"message": "Key is mismatched!",
+		})
+		return
+	}
+
+	// the caller only needs to know the key is good, not who it was issued to
+	ctx.JSON(http.StatusOK, gin.H{"scopes": apiKey.Scopes})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// where the logger keeps the audit trail of the whole stack, the events of this service are
+// sent there through the outbox and it is searched there
+var auditServiceURL = "http://logger-service/audit"
+
+func init() {
+	if os.Getenv("AUDIT_SERVICE_URL") != "" {
+		auditServiceURL = os.Getenv("AUDIT_SERVICE_URL")
+	}
+}
+
+// the query parameters of ListAudit that are passed on to the logger
+var auditQueryParameters = []string{"service", "action", "actor", "target", "from", "to", "page", "page_size"}
+
+// recordEvent stores an event of the audit trail, failing to do so doesn't fail the request
+func (app *Config) recordEvent(event data.AuthEvent) {
+	if err := app.Models.AuthEvent.Record(event); err != nil {
+		log.Printf("Can't record %s event of %s: %s", event.Type, event.Email, err)
+	}
+}
+
+// recordChange stores event with what it changed, before and after are nil for something
+// created or removed
+func (app *Config) recordChange(event data.AuthEvent, before, after interface{}) {
+	event.Before, event.After = before, after
+
+	app.recordEvent(event)
+}
+
+// ListAudit returns one page of the audit trail of the stack, the latest entries first. It is
+// filtered by the service, action, actor, target, from and to query parameters, the times in
+// RFC 3339, and paged by page and page_size. The logger, which keeps the trail, answers it.
+func (app *Config) ListAudit(ctx *gin.Context) {
+	query := url.Values{}
+	for _, name := range auditQueryParameters {
+		if value := ctx.Query(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(auditServiceURL + "?" + query.Encode())
+	if err != nil {
+		log.Printf("Can't search the audit trail: %s", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"error":   "true",
+			"message": "The audit trail can't be reached",
+		})
+		return
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"error":   "true",
+			"message": "The audit trail can't be reached",
+		})
+		return
+	}
+
+	ctx.Data(response.StatusCode, "application/json; charset=utf-8", body)
+}
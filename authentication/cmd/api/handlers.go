@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,7 +13,6 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/welab2022/LCS2-Micro/authentication/data"
 )
 
@@ -22,27 +24,16 @@ type mailMessage struct {
 }
 
 type jsonResponse struct {
-	Status  string
-	Message string
-	API     string
-	Data    interface{}
+	Status      string
+	Message     string
+	AccessToken string
+	ExpiresIn   int
+	Challenge   string
+	Data        interface{}
 }
 
-// each session contains the username of the user and the time at which it expires
-type session struct {
-	username string
-	expiry   time.Time
-}
-
-var sessions = map[string]session{}
-
 const SESSION_TOKEN = "lcs2_session_token"
 
-// we'll use this method later to determine if the session has expired
-func (s session) isExpired() bool {
-	return s.expiry.Before(time.Now())
-}
-
 // Create a struct that models the structure of a user in the request body
 type Credentials struct {
 	Password string `json:"password"`
@@ -87,38 +78,102 @@ func (app *Config) Signin(ctx *gin.Context) {
 		return
 	}
 
-	// validate the user against database
+	if !app.checkSigninAllowed(ctx, requestPayload.Email) {
+		return
+	}
+
+	// validate the user against database, an unknown email and a wrong password get the same answer
+	valid := false
 	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	if err == nil {
+		valid, _ = user.PasswordMatches(requestPayload.Password)
+	} else {
+		compareDummyPassword(requestPayload.Password)
+	}
 
-	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Invalid email"})
+	if !valid {
+		app.recordSigninFailure(ctx, requestPayload.Email)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	valid, err := user.PasswordMatches(requestPayload.Password)
-	if err != nil || !valid {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Invalid password"})
+	// only the right password tells whether the account is active
+	if user.Active != 1 {
+		app.endSessions(user.Email)
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Your account is not active"})
 		return
 	}
 
-	sessionToken := uuid.NewString()
-	expiresAt := time.Now().Add(1000 * 60 * 60 * 24 * 30 * time.Second) // 30 days
+	// with a second factor the password only gets a challenge to answer at /signin/2fa
+	secondFactor, err := app.Models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrTOTPNotFound) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
 
-	// Set the token in the session map, along with the user whom it represents
-	sessions[sessionToken] = session{
-		username: requestPayload.Email,
-		expiry:   expiresAt,
+	if secondFactor.Enabled() {
+		challenge, err := signMFAChallenge(user)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't create challenge"})
+			return
+		}
+
+		ctx.JSON(http.StatusAccepted, jsonResponse{
+			Status:    "mfa_required",
+			Message:   "Enter the code of your authenticator app or a recovery code",
+			Challenge: challenge,
+		})
+		return
 	}
 
-	api_key := GenerateTokenBase64()
+	app.completeSignin(ctx, user)
+}
+
+// completeSignin starts the session of a user who proved who they are
+func (app *Config) completeSignin(ctx *gin.Context, user *data.User) {
+	if err := app.Models.LoginFailures.Reset(user.Email); err != nil {
+		log.Printf("Can't reset failed sign-ins of %s: %s", user.Email, err)
+	}
+
+	// Store a new session token, along with the user whom it represents
+	userSession, err := app.startSession(user.Email, ctx.ClientIP(), ctx.Request.UserAgent())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't create session"})
+		return
+	}
 
 	payload := jsonResponse{
 		Status:  "success",
 		Message: fmt.Sprintf("Authenticated! Logged in user: %s", user.Email),
-		API:     api_key,
 		Data:    user,
 	}
 
+	// users with an expired password or a missing second factor only get a session to fix it, not an access token
+	action, err := app.pendingAction(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if action != "" {
+		payload.Message = fmt.Sprintf("Logged in user: %s. %s", user.Email, action)
+	} else {
+		accessToken, _, err := app.Tokens.Issue(user)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't issue access token"})
+			return
+		}
+		payload.AccessToken = accessToken
+		payload.ExpiresIn = int(accessTokenLifetime.Seconds())
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:   data.EventSignin,
+		Email:  user.Email,
+		IP:     ctx.ClientIP(),
+		Detail: ctx.Request.UserAgent(),
+	})
+
 	// update the last_login
 	now := time.Now()
 	err = user.LastLoginUpdate(now, user.Email)
@@ -131,8 +186,8 @@ func (app *Config) Signin(ctx *gin.Context) {
 	// we also set an expiry time of 120 seconds
 	http.SetCookie(ctx.Writer, &http.Cookie{
 		Name:     SESSION_TOKEN,
-		Value:    sessionToken,
-		Expires:  expiresAt,
+		Value:    userSession.Token,
+		Expires:  userSession.Expiry,
 		SameSite: http.SameSiteNoneMode,
 		Secure:   true,
 	})
@@ -155,7 +210,7 @@ func (app *Config) Signin(ctx *gin.Context) {
 //	    description: Service not found
 func (app *Config) Logout(ctx *gin.Context) {
 
-	sessionToken, err := app.validateSession(ctx)
+	userSession, err := app.validateSession(ctx)
 	if err != nil {
 		return
 	}
@@ -174,7 +229,7 @@ func (app *Config) Logout(ctx *gin.Context) {
 		return
 	}
 
-	if requestPayload.Email != sessions[sessionToken].username {
+	if requestPayload.Email != userSession.Username {
 		ctx.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "true",
 			"message": "You must to sign in before log out",
@@ -182,8 +237,18 @@ func (app *Config) Logout(ctx *gin.Context) {
 		return
 	}
 
-	// remove the users session from the session map
-	delete(sessions, sessionToken)
+	// remove the users session from the session store
+	err = app.Sessions.Delete(userSession.Token)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't remove session"})
+		return
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventLogout,
+		Email: userSession.Username,
+		IP:    ctx.ClientIP(),
+	})
 
 	// We need to let the client know that the cookie is expired
 	// In the response, we set the session token to an empty
@@ -198,41 +263,78 @@ func (app *Config) Logout(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out!"})
 }
 
-func (app *Config) validateSession(ctx *gin.Context) (string, error) {
+func (app *Config) validateSession(ctx *gin.Context) (*data.Session, error) {
 
 	c, err := ctx.Request.Cookie(SESSION_TOKEN)
 	if err != nil {
 		if err == http.ErrNoCookie {
 			// If the cookie is not set, return an unauthorized status
 			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return "", err
+			return nil, err
 		}
 		// For any other type of error, return a bad request status
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Bad request"})
-		return "", err
+		return nil, err
 	}
 
 	sessionToken := c.Value
 
-	// We then get the name of the user from our session map, where we set the session token
-	userSession, exists := sessions[sessionToken]
-	if !exists {
-		// If the session token is not present in session map, return an unauthorized error
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return "", err
+	// We then get the name of the user from our session store, where we set the session token
+	userSession, err := app.Sessions.Get(sessionToken)
+	if err != nil {
+		if errors.Is(err, data.ErrSessionNotFound) {
+			// If the session token is not present in session store, return an unauthorized error
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return nil, err
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't read session"})
+		return nil, err
 	}
 
-	if userSession.isExpired() {
-		delete(sessions, sessionToken)
+	if userSession.IsExpired() {
+		app.Sessions.Delete(sessionToken)
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Expired => Unauthorized. Please refresh your session!"})
-		return "", err
+		return nil, errSessionExpired
+	}
+
+	// the account may have been deactivated or deleted since the session started
+	user, err := app.Models.User.GetByEmail(userSession.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return nil, err
+	}
+	if err != nil || user.Active != 1 {
+		app.endSessions(userSession.Username)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Your account is not active"})
+		return nil, errAccountInactive
+	}
+
+	app.touchSession(userSession, ctx.ClientIP())
+
+	return userSession, nil
+}
+
+// WhoAmI returns the user signed in with the session cookie. Other services call it
+// to find out which staff member is behind a request.
+func (app *Config) WhoAmI(ctx *gin.Context) {
+	userSession, err := app.validateSession(ctx)
+	if err != nil {
+		return
+	}
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	user, err := app.Models.User.GetByEmail(userSession.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
 	}
 
-	return sessionToken, nil
+	ctx.JSON(http.StatusOK, user)
 }
 
 func (app *Config) GetUser(ctx *gin.Context) {
-	sessionToken, err := app.validateSession(ctx)
+	userSession, err := app.validateSession(ctx)
 	if err != nil {
 		return
 	}
@@ -240,7 +342,7 @@ func (app *Config) GetUser(ctx *gin.Context) {
 	ctx.Header("Content-Type", "application/json; charset=utf-8")
 
 	email := ctx.Param("email")
-	if sessions[sessionToken].username != email {
+	if userSession.Username != email {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"message": "No permission, unthorized",
 		})
@@ -258,22 +360,12 @@ func (app *Config) GetUser(ctx *gin.Context) {
 
 func (app *Config) AddUser(ctx *gin.Context) {
 
-	sessionToken, err := app.validateSession(ctx)
-	if err != nil {
-		return
-	}
-
-	if sessions[sessionToken].username != "admin@example.com" {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "No permission to add a new user"})
-		return
-	}
-
 	// user info request
 	var requestPayload struct {
 		Email     string `json:"email"`
 		FirstName string `json:"first_name,omitempty"`
 		LastName  string `json:"last_name,omitempty"`
-		Password  string `json:"password"`
+		Role      string `json:"role,omitempty"`
 	}
 
 	var responseUser struct {
@@ -283,7 +375,7 @@ func (app *Config) AddUser(ctx *gin.Context) {
 
 	ctx.Header("Content-Type", "application/json; charset=utf-8")
 
-	if err = ctx.ShouldBindJSON(&requestPayload); err != nil {
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error":   "true",
 			"message": err.Error(),
@@ -292,6 +384,18 @@ func (app *Config) AddUser(ctx *gin.Context) {
 		return
 	}
 
+	if requestPayload.Role == "" {
+		requestPayload.Role = data.RoleReadOnly
+	}
+
+	if !data.ValidRole(requestPayload.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("Unknown role %s", requestPayload.Role),
+		})
+		return
+	}
+
 	// check if the user against database is existed
 	exist_user, err := app.Models.User.GetByEmail(requestPayload.Email)
 
@@ -301,13 +405,20 @@ func (app *Config) AddUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, responseUser)
 		return
 	}
-	// password needs to be generated and sent through a user registration email
+	// the user stays pending with a password nobody knows until they accept the invitation
+	placeholder := make([]byte, 32)
+	if _, err := rand.Read(placeholder); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't create user"})
+		return
+	}
+
 	var user data.User
 	user.Email = requestPayload.Email
 	user.FirstName = requestPayload.FirstName
 	user.LastName = requestPayload.LastName
-	user.Password = requestPayload.Password
-	user.Active = 1
+	user.Password = ToBase64(placeholder)
+	user.Role = requestPayload.Role
+	user.Active = 0
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	user.LastLogin = time.Time{}
@@ -319,57 +430,96 @@ func (app *Config) AddUser(ctx *gin.Context) {
 		return
 	}
 
-	responseUser.Status = "User added!"
-	responseUser.Message = fmt.Sprintf("User %s added and id: %d!", requestPayload.Email, id)
+	user.ID = id
+
+	app.recordChange(data.AuthEvent{
+		Type:  data.EventUserAdded,
+		Email: user.Email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	}, nil, user)
+
+	if err := app.sendInvitation(&user); err != nil {
+		log.Printf("Can't send invitation to user %d: %s", id, err)
+		responseUser.Status = "User added!"
+		responseUser.Message = fmt.Sprintf("User %s added and id: %d, but the invitation wasn't created, please send it again!", requestPayload.Email, id)
+		ctx.JSON(http.StatusOK, responseUser)
+		return
+	}
 
-	// need to send an email notification
-	// ...
+	responseUser.Status = "User added!"
+	responseUser.Message = fmt.Sprintf("User %s added and id: %d, an invitation was sent to them!", requestPayload.Email, id)
 
 	ctx.JSON(http.StatusOK, responseUser)
 }
 
 func (app *Config) Refresh(ctx *gin.Context) {
 
-	sessionToken, err := app.validateSession(ctx)
+	userSession, err := app.validateSession(ctx)
 	if err != nil {
 		return
 	}
 
-	// We then get the name of the user from our session map, where we set the session token
-	userSession, exists := sessions[sessionToken]
-	if !exists {
-		// If the session token is not present in session map, return an unauthorized error
+	user, err := app.Models.User.GetByEmail(userSession.Username)
+	if err != nil {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	// If the previous session is valid, create a new session token for the current user
-	newSessionToken := uuid.NewString()
-	expiresAt := time.Now().Add(1000 * 60 * 60 * 24 * 30 * time.Second)
-
-	// Set the token in the session map, along with the user whom it represents
-	sessions[newSessionToken] = session{
-		username: userSession.username,
-		expiry:   expiresAt,
+	// If the previous session is valid, swap it for a new session token in one step,
+	// so the same token can't be refreshed twice by concurrent requests
+	newSession, err := app.rotateSession(userSession, ctx.ClientIP())
+	if err != nil {
+		if errors.Is(err, data.ErrSessionNotFound) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't create session"})
+		return
 	}
 
-	// Delete the older session token
-	delete(sessions, sessionToken)
-
 	// Finally, we set the client cookie for SESSION_TOKEN as the session token we just generated
 	// we also set an expiry time of 120 seconds
 	http.SetCookie(ctx.Writer, &http.Cookie{
 		Name:     SESSION_TOKEN,
-		Value:    newSessionToken,
-		Expires:  expiresAt,
+		Value:    newSession.Token,
+		Expires:  newSession.Expiry,
 		SameSite: http.SameSiteNoneMode,
 	})
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Session refreshed OK!"})
+	action, err := app.pendingAction(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if action != "" {
+		ctx.JSON(http.StatusOK, gin.H{"message": "Session refreshed OK! " + action})
+		return
+	}
+
+	// the roles in the new access token are read again, so role changes apply on the next refresh
+	accessToken, _, err := app.Tokens.Issue(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't issue access token"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":      "Session refreshed OK!",
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(accessTokenLifetime.Seconds()),
+	})
+}
+
+// JWKS publishes the public key access tokens are signed with
+func (app *Config) JWKS(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, app.Tokens.JWKS())
 }
 
 func (app *Config) ChangePassword(ctx *gin.Context) {
-	sessionToken, err := app.validateSession(ctx)
+	userSession, err := app.validateSession(ctx)
 	if err != nil {
 		return
 	}
@@ -396,7 +546,7 @@ func (app *Config) ChangePassword(ctx *gin.Context) {
 		return
 	}
 
-	if sessions[sessionToken].username != requestPayload.Email {
+	if userSession.Username != requestPayload.Email {
 		ctx.JSON(http.StatusNotFound, gin.H{"message": "%s is not authenticated yet, please sign in to the system"})
 		return
 	}
@@ -418,19 +568,29 @@ func (app *Config) ChangePassword(ctx *gin.Context) {
 		return
 	}
 
-	err = user.ResetPassword(requestPayload.NewPassword)
+	if app.rejectPassword(ctx, user.ID, user.Email, requestPayload.NewPassword) {
+		return
+	}
+
+	err = user.ResetPassword(requestPayload.NewPassword, passwordChangedMail(user))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Change password failure"})
 		return
 	}
 
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventPasswordChanged,
+		Email: user.Email,
+		IP:    ctx.ClientIP(),
+	})
+
 	responseUser.Status = "OK"
 	responseUser.Message = "Password changed successfully"
 	ctx.JSON(http.StatusOK, responseUser)
 }
 
 func (app *Config) UpdateAvatar(ctx *gin.Context) {
-	sessionToken, err := app.validateSession(ctx)
+	userSession, err := app.validateSession(ctx)
 	if err != nil {
 		return
 	}
@@ -453,7 +613,7 @@ func (app *Config) UpdateAvatar(ctx *gin.Context) {
 	}
 
 	// need to be authorized here, session to get the email
-	email := sessions[sessionToken].username
+	email := userSession.Username
 
 	err = app.Models.User.UpdateAvatar(buf.Bytes(), email)
 	if err != nil {
@@ -463,6 +623,12 @@ func (app *Config) UpdateAvatar(ctx *gin.Context) {
 		return
 	}
 
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventAvatarChanged,
+		Email: email,
+		IP:    ctx.ClientIP(),
+	})
+
 	// File saved successfully. Return proper result
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "Your file has been successfully uploaded.",
@@ -470,7 +636,7 @@ func (app *Config) UpdateAvatar(ctx *gin.Context) {
 }
 
 func (app *Config) GetAvatar(ctx *gin.Context) {
-	sessionToken, err := app.validateSession(ctx)
+	userSession, err := app.validateSession(ctx)
 	if err != nil {
 		return
 	}
@@ -478,7 +644,7 @@ func (app *Config) GetAvatar(ctx *gin.Context) {
 	ctx.Header("Content-Type", "application/json; charset=utf-8")
 
 	email := ctx.Param("email")
-	if sessions[sessionToken].username != email {
+	if userSession.Username != email {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"message": "No permission, unthorized",
 		})
@@ -521,11 +687,6 @@ func (app *Config) GetAvatar(ctx *gin.Context) {
 }
 
 func (app *Config) ListAllUsers(ctx *gin.Context) {
-	_, err := app.validateSession(ctx)
-	if err != nil {
-		return
-	}
-
 	ctx.Header("Content-Type", "application/json; charset=utf-8")
 
 	users, err := app.Models.User.GetAll()
@@ -538,20 +699,41 @@ func (app *Config) ListAllUsers(ctx *gin.Context) {
 
 }
 
-func (app *Config) ResetPassword(ctx *gin.Context) {
-	_, err := app.validateSession(ctx)
+// sendMail hands mail to the mail service, which queues it and delivers it in the background.
+// Handlers don't call it, their mails go through the outbox.
+func (app *Config) sendMail(mail mailMessage) error {
+
+	jsonData, _ := json.MarshalIndent(mail, "", "\t")
+	request, err := http.NewRequest("POST", mailServiceURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return
+		log.Printf("newMessage: sendMail failed %s", err)
+		return err
 	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-KEY", mailAPIKey)
 
-	// user info request for changing password
-	var requestPayload struct {
-		Email string `json:"email"`
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		log.Printf("http: sendMail failed %s", err)
+		return err
 	}
+	defer response.Body.Close()
 
-	var responseUser struct {
-		Status  string
-		Message string
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("mail service responded with %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+func (app *Config) ListRoles(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, data.Roles())
+}
+
+func (app *Config) SetUserRole(ctx *gin.Context) {
+	var requestPayload struct {
+		Role string `json:"role" binding:"required"`
 	}
 
 	ctx.Header("Content-Type", "application/json; charset=utf-8")
@@ -564,64 +746,46 @@ func (app *Config) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
-	// check if the user against database is existed
-	user, err := app.Models.User.GetByEmail(requestPayload.Email)
-	if err != nil {
-		// the user doesn't exists
-		responseUser.Status = "error"
-		responseUser.Message = fmt.Sprintf("User %s doesn't exist!", requestPayload.Email)
-		ctx.JSON(http.StatusNotFound, responseUser)
+	if !data.ValidRole(requestPayload.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("Unknown role %s", requestPayload.Role),
+		})
 		return
 	}
 
-	// generate the reset password
-	rstpassword, _ := GeneratePassword()
-
-	log.Printf("reset password: %s", rstpassword)
+	email := ctx.Param("email")
 
-	err = user.ResetPassword(rstpassword)
+	user, err := app.Models.User.GetByEmail(email)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't reset password"})
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("User %s doesn't exist!", email)})
 		return
 	}
 
-	responseUser.Status = "Reset succeeded"
-	responseUser.Message = fmt.Sprintf("Reset password is sent to email: %s", requestPayload.Email)
-
-	// sent email
-	var mail mailMessage
-	mail.From = "admin@example.com"
-	mail.To = requestPayload.Email
-	mail.Subject = "Reset password"
-
-	mail.Message = fmt.Sprintf("Hello,\n reset password is %s", rstpassword)
-
-	err = app.sendMail(mail)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't send reset password email"})
+	// an admin can't lock themselves out of role management
+	if user.ID == currentUser(ctx).ID && requestPayload.Role != data.RoleAdmin {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "You can't remove your own admin role",
+		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, responseUser)
-
-}
-
-func (app *Config) sendMail(mail mailMessage) error {
-
-	mailServiceURL := "http://host.docker.internal:9001/send"
-	jsonData, _ := json.MarshalIndent(mail, "", "\t")
-	request, err := http.NewRequest("POST", mailServiceURL, bytes.NewBuffer(jsonData))
+	err = app.Models.User.SetRole(user.ID, requestPayload.Role)
 	if err != nil {
-		log.Printf("newMessage: sendMail failed %s", err)
-		return err
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil || response.StatusCode != 202 {
-		log.Printf("http: sendMail failed %s", err)
-		return err
-	}
+	app.recordChange(data.AuthEvent{
+		Type:  data.EventRoleChanged,
+		Email: user.Email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	}, gin.H{"role": user.Role}, gin.H{"role": requestPayload.Role})
 
-	return nil
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "OK",
+		"message": fmt.Sprintf("User %s is now %s", email, requestPayload.Role),
+	})
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// how long an invitation link can be used, expired ones can be sent again
+const invitationLifetime = 7 * 24 * time.Hour
+
+// the audience of invitation tokens, so they can't be mistaken for anything else
+const invitationAudience = "lcs2-invitation"
+
+// the page of the front-end the invitation link opens, the token is appended to it
+var invitationURL = "http://localhost/accept-invitation?token="
+
+func init() {
+	if os.Getenv("INVITATION_URL") != "" {
+		invitationURL = os.Getenv("INVITATION_URL")
+	}
+}
+
+// signInvitation returns the token of the invitation link
+func signInvitation(invitation *data.Invitation) (string, error) {
+	return signPurposeToken(invitationAudience, jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(invitation.UserID),
+		ID:        strconv.Itoa(invitation.ID),
+		IssuedAt:  jwt.NewNumericDate(invitation.CreatedAt),
+		ExpiresAt: jwt.NewNumericDate(invitation.ExpiresAt),
+	})
+}
+
+// parseInvitation checks the signature and lifetime of an invitation token
+// and returns the ids of the invitation and of the invited user
+func parseInvitation(token string) (int, int, error) {
+	claims, err := parsePurposeToken(invitationAudience, token)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	id, err := strconv.Atoi(claims.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, userID, nil
+}
+
+// sendInvitation creates a new invitation for a pending user, its link is emailed once it's stored
+func (app *Config) sendInvitation(user *data.User) error {
+	_, err := app.Models.Invitation.Insert(user.ID, invitationLifetime, func(invitation *data.Invitation) ([]data.OutboxEvent, error) {
+		token, err := signInvitation(invitation)
+		if err != nil {
+			return nil, err
+		}
+
+		var mail mailMessage
+		mail.From = "admin@example.com"
+		mail.To = user.Email
+		mail.Subject = "Your LCS2 account"
+		mail.Message = fmt.Sprintf("Hello %s,\n an account was created for you.\n Open %s%s to choose your password.\n The link expires in %d days.",
+			user.FirstName, invitationURL, token, int(invitationLifetime.Hours()/24))
+
+		return []data.OutboxEvent{mailEvent(mail)}, nil
+	})
+
+	return err
+}
+
+// ResendInvitation sends a new invitation link to a user who hasn't accepted theirs,
+// the links sent before stop working
+func (app *Config) ResendInvitation(ctx *gin.Context) {
+	email := ctx.Param("email")
+
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("User %s doesn't exist!", email)})
+		return
+	}
+
+	if user.Active != 0 {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("User %s has already accepted the invitation", email),
+		})
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("User %s is deactivated", email),
+		})
+		return
+	}
+
+	if err := app.sendInvitation(user); err != nil {
+		log.Printf("Can't send invitation to user %d: %s", user.ID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't send invitation email"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Invitation sent to %s", email),
+	})
+}
+
+// AcceptInvitation sets the password the invitee chose and activates the account
+func (app *Config) AcceptInvitation(ctx *gin.Context) {
+	var requestPayload data.ResetPasswordInput
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if requestPayload.Password != requestPayload.PasswordConfirm {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "Passwords don't match",
+		})
+		return
+	}
+
+	// a token that doesn't verify is reported like one that was already used
+	var user *data.User
+	id, userID, err := parseInvitation(ctx.Param("token"))
+	if err != nil {
+		err = data.ErrInvitationInvalid
+	} else {
+		user, err = app.Models.User.GetOne(userID)
+		if err == nil {
+			if app.rejectPassword(ctx, user.ID, user.Email, requestPayload.Password) {
+				return
+			}
+			err = app.Models.Invitation.Accept(id, userID, requestPayload.Password)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrInvitationInvalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": "The invitation link is invalid or has expired, please ask for a new one",
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventInvitationAccepted,
+		Email: user.Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Account activated, you can sign in now",
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+func TestInvitations_TokenRoundTrip(t *testing.T) {
+	now := time.Now()
+	invitation := &data.Invitation{ID: 7, UserID: 42, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	token, err := signInvitation(invitation)
+	if err != nil {
+		t.Fatalf("signInvitation: %s", err)
+	}
+
+	id, userID, err := parseInvitation(token)
+	if err != nil {
+		t.Fatalf("parseInvitation: %s", err)
+	}
+	if id != 7 || userID != 42 {
+		t.Errorf("expected invitation 7 of user 42, got %d of %d", id, userID)
+	}
+
+	if _, _, err := parseInvitation(token[:len(token)-2] + "xx"); err == nil {
+		t.Errorf("tampered token should be rejected")
+	}
+}
+
+func TestInvitations_RejectsExpiredAndOtherTokens(t *testing.T) {
+	past := time.Now().Add(-2 * time.Hour)
+	expired, err := signInvitation(&data.Invitation{ID: 1, UserID: 1, CreatedAt: past, ExpiresAt: past.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("signInvitation: %s", err)
+	}
+
+	if _, _, err := parseInvitation(expired); err == nil {
+		t.Errorf("expired invitation should be rejected")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, _, err := newTokenIssuerWithKey(key).Issue(&data.User{ID: 1, Email: "user@example.com"})
+	if err != nil {
+		t.Fatalf("Issue: %s", err)
+	}
+
+	if _, _, err := parseInvitation(accessToken); err == nil {
+		t.Errorf("access token should not be accepted as an invitation")
+	}
+}
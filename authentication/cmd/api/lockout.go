@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// failed sign-ins of an account before it has to wait between attempts
+	accountFreeAttempts = 3
+	// every this many failed sign-ins lock the account, each lockout twice as long as the last
+	accountLockThreshold = 5
+	accountLockDuration  = 15 * time.Minute
+	maxAccountLock       = 24 * time.Hour
+
+	// failed sign-ins from one IP before it has to wait between attempts, many users can share an IP
+	ipFreeAttempts = 10
+	maxLoginDelay  = time.Minute
+
+	// the failures of an account are forgotten after this long without a new one. It outlasts
+	// the longest lock, so the failures after a lock keep doubling the next one.
+	loginFailureMemory = maxAccountLock + time.Hour
+	// the failures of an IP only slow it down for a minute at most, they are forgotten sooner
+	ipFailureMemory = time.Hour
+)
+
+// progressiveDelay is how long to wait after the last failure before the next attempt,
+// doubling with every failure past the free ones
+func progressiveDelay(failures, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	shift := failures - free
+	if shift > 16 {
+		return maxLoginDelay
+	}
+
+	delay := time.Second << shift
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// accountLockFor is how long an account is locked after its failures-th failed sign-in
+func accountLockFor(failures int) time.Duration {
+	if failures == 0 || failures%accountLockThreshold != 0 {
+		return 0
+	}
+
+	lockouts := failures/accountLockThreshold - 1
+	duration := time.Duration(float64(accountLockDuration) * math.Pow(2, float64(lockouts)))
+	if duration <= 0 || duration > maxAccountLock {
+		return maxAccountLock
+	}
+	return duration
+}
+
+// ipWait is how long the client IP with failures has to wait at now before its next attempt
+func ipWait(failures *data.IPLoginFailures, now time.Time) time.Duration {
+	if failures.Failures == 0 || now.Sub(failures.LastFailureAt) > ipFailureMemory {
+		return 0
+	}
+
+	wait := failures.LastFailureAt.Add(progressiveDelay(failures.Failures, ipFreeAttempts)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// a password hash to compare with when the email has no account,
+// so the response time doesn't tell whether the account exists
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), 12)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// tooManyAttempts answers a sign-in that has to wait
+func tooManyAttempts(ctx *gin.Context, wait time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed sign-ins, try again later"})
+}
+
+// checkSigninAllowed answers and returns false when the client or the account has to wait
+// before trying again
+func (app *Config) checkSigninAllowed(ctx *gin.Context, email string) bool {
+	now := time.Now()
+
+	ipFailures, err := app.Models.IPLoginFailures.Get(ctx.ClientIP())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return false
+	}
+
+	if wait := ipWait(ipFailures, now); wait > 0 {
+		tooManyAttempts(ctx, wait)
+		return false
+	}
+
+	failures, err := app.Models.LoginFailures.Get(email)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return false
+	}
+
+	if failures.Locked(now) {
+		tooManyAttempts(ctx, failures.LockedUntil.Sub(now))
+		return false
+	}
+
+	if failures.Failures > 0 {
+		wait := failures.LastFailureAt.Add(progressiveDelay(failures.Failures, accountFreeAttempts)).Sub(now)
+		if wait > 0 {
+			tooManyAttempts(ctx, wait)
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordSigninFailure counts a failed sign-in against the client and the account
+// and records a lockout when it locks the account
+func (app *Config) recordSigninFailure(ctx *gin.Context, email string) {
+	ip := ctx.ClientIP()
+	if _, err := app.Models.IPLoginFailures.RecordFailure(ip, ipFailureMemory); err != nil {
+		log.Printf("Can't record failed sign-in from %s: %s", ip, err)
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventSigninFailed,
+		Email: email,
+		IP:    ip,
+	})
+
+	failures, err := app.Models.LoginFailures.RecordFailure(email, loginFailureMemory, accountLockFor)
+	if err != nil {
+		log.Printf("Can't record failed sign-in: %s", err)
+		return
+	}
+
+	if failures.LockedUntil != nil {
+		log.Printf("Account %s locked until %s after %d failed sign-ins", failures.Email, failures.LockedUntil.Format(time.RFC3339), failures.Failures)
+
+		app.recordEvent(data.AuthEvent{
+			Type:   data.EventAccountLocked,
+			Email:  failures.Email,
+			IP:     ip,
+			Detail: fmt.Sprintf("locked until %s after %d failed sign-ins", failures.LockedUntil.Format(time.RFC3339), failures.Failures),
+		})
+	}
+}
+
+// UnlockUser lifts the lockout of an account and forgets its failed sign-ins
+func (app *Config) UnlockUser(ctx *gin.Context) {
+	email := ctx.Param("email")
+
+	err := app.Models.LoginFailures.Reset(email)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventAccountUnlocked,
+		Email: email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("User %s unlocked", email),
+	})
+}
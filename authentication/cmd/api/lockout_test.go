@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+func TestLockout_ProgressiveDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{20, maxLoginDelay},
+		{100, maxLoginDelay},
+	}
+
+	for _, tt := range tests {
+		if got := progressiveDelay(tt.failures, accountFreeAttempts); got != tt.want {
+			t.Errorf("%d failures: expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func TestLockout_AccountLockDoublesEveryThreshold(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{4, 0},
+		{5, accountLockDuration},
+		{6, 0},
+		{10, 2 * accountLockDuration},
+		{15, 4 * accountLockDuration},
+		{500, maxAccountLock},
+	}
+
+	for _, tt := range tests {
+		if got := accountLockFor(tt.failures); got != tt.want {
+			t.Errorf("%d failures: expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func TestLockout_IPWait(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		failures int
+		last     time.Time
+		want     time.Duration
+	}{
+		{"no failures", 0, time.Time{}, 0},
+		{"free attempts", ipFreeAttempts - 1, now, 0},
+		{"first delay", ipFreeAttempts, now, time.Second},
+		{"delay run out", ipFreeAttempts, now.Add(-2 * time.Second), 0},
+		{"partly waited", ipFreeAttempts + 1, now.Add(-time.Second), time.Second},
+		{"forgotten", ipFreeAttempts + 20, now.Add(-ipFailureMemory - time.Second), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := &data.IPLoginFailures{IP: "10.0.0.1", Failures: tt.failures, LastFailureAt: tt.last}
+			if got := ipWait(failures, now); got != tt.want {
+				t.Errorf("expected to wait %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLockout_FailuresOutlastLongestLock(t *testing.T) {
+	// a failure right after the longest lock runs out still counts towards the next one
+	if loginFailureMemory <= maxAccountLock {
+		t.Errorf("failures are forgotten after %s, before the %s lock runs out", loginFailureMemory, maxAccountLock)
+	}
+}
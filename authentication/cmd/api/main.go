@@ -16,8 +16,11 @@ import (
 var counts int64
 
 type Config struct {
-	DB     *sql.DB
-	Models data.Models
+	DB        *sql.DB
+	Models    data.Models
+	Sessions  data.SessionStore
+	Tokens    *TokenIssuer
+	Passwords data.PasswordPolicy
 }
 
 func main() {
@@ -30,12 +33,40 @@ func main() {
 		log.Panic("Can't connect to Postgres!")
 	}
 
+	tokens, err := newTokenIssuer()
+	if err != nil {
+		log.Panic("Can't load the token signing key: ", err)
+	}
+
+	if err := loadTokenSecret(); err != nil {
+		log.Panic("Can't load the token secret: ", err)
+	}
+
+	mailAPIKey, err = secretFromEnv("MAIL_API_KEY")
+	if err != nil {
+		log.Panic("Can't load the mail api key: ", err)
+	}
+	if mailAPIKey == "" {
+		log.Println("MAIL_API_KEY is not set, the mail service will refuse the mails")
+	}
+
 	// set up config
 	app := Config{
-		DB:     conn,
-		Models: data.New(conn),
+		DB:        conn,
+		Models:    data.New(conn),
+		Sessions:  newSessionStore(),
+		Tokens:    tokens,
+		Passwords: newPasswordPolicy(),
 	}
 
+	// remove expired sessions and reset tokens in the background
+	go app.collectExpiredSessions(sessionGCInterval)
+	go app.collectExpiredResets(sessionGCInterval)
+
+	// deliver the mail and events written to the outbox
+	go app.relayOutbox()
+	go app.collectDeliveredOutbox(time.Hour)
+
 	// Start auth service
 	app.startApp()
 }
@@ -3,9 +3,15 @@ package main
 import (
 	"log"
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// the gin context keys the middlewares store the signed-in user and the client's API key under
+const (
+	userKey   = "user"
+	apiKeyKey = "apiKey"
 )
 
 func AddCorsHeaders() gin.HandlerFunc {
@@ -15,11 +21,11 @@ func AddCorsHeaders() gin.HandlerFunc {
 
 }
 
-func AuthMiddleWare() gin.HandlerFunc {
+// AuthMiddleWare only lets through requests carrying an API key issued for this service
+func (app *Config) AuthMiddleWare() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		log.Printf("Client IP: %s", c.ClientIP())
-		log.Printf("Request header: %s", c.Request.Header)
 
 		if c.Request.Method == "OPTIONS" {
 			log.Printf("CORS headers")
@@ -34,7 +40,8 @@ func AuthMiddleWare() gin.HandlerFunc {
 			return
 		}
 
-		if c.GetHeader("X-API-KEY") != os.Getenv("X_API_KEY") {
+		apiKey, err := app.checkAPIKey(c.GetHeader("X-API-KEY"), data.ScopeAuthentication)
+		if err != nil {
 			c.JSON(http.StatusNotAcceptable, gin.H{
 				"error":   "true",
 				"message": "Key is mismatched!",
@@ -42,6 +49,62 @@ func AuthMiddleWare() gin.HandlerFunc {
 			c.AbortWithStatus(401)
 			return
 		}
+
+		c.Set(apiKeyKey, apiKey)
 		c.Next()
 	}
 }
+
+// RequirePermission only lets the request through when the signed-in user's role
+// grants perm. The user is stored in the context, see currentUser.
+func (app *Config) RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userSession, err := app.validateSession(c)
+		if err != nil {
+			c.Abort()
+			return
+		}
+
+		user, err := app.Models.User.GetByEmail(userSession.Username)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		action, err := app.pendingAction(user)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+			return
+		}
+
+		if action != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "true",
+				"message": action,
+			})
+			return
+		}
+
+		if !user.HasPermission(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "true",
+				"message": "No permission, " + perm + " is required",
+			})
+			return
+		}
+
+		c.Set(userKey, user)
+		c.Next()
+	}
+}
+
+// currentUser returns the user stored by RequirePermission
+func currentUser(c *gin.Context) *data.User {
+	value, exists := c.Get(userKey)
+	if !exists {
+		return nil
+	}
+
+	user, _ := value.(*data.User)
+	return user
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+const (
+	// how often the relay looks for messages when the outbox was empty
+	outboxPollInterval = 2 * time.Second
+	// how long the relay may take to deliver one message before another replica can claim it,
+	// well over the timeout of a delivery
+	outboxLease = time.Minute
+	// a failed message is tried again after outboxRetryBase, twice as long after each
+	// further failure, up to outboxRetryMax, and is dead once it failed outboxMaxAttempts times
+	outboxRetryBase   = 5 * time.Second
+	outboxRetryMax    = time.Hour
+	outboxMaxAttempts = 12
+	// how long delivered and dead messages are kept
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// where the events that aren't mail are sent, the logger keeps them with the rest of the logs
+var loggerServiceURL = "http://logger-service/log"
+
+func init() {
+	if os.Getenv("LOGGER_SERVICE_URL") != "" {
+		loggerServiceURL = os.Getenv("LOGGER_SERVICE_URL")
+	}
+}
+
+// mailEvent is the outbox event asking the mail service to send mail
+func mailEvent(mail mailMessage) data.OutboxEvent {
+	return data.OutboxEvent{Topic: data.TopicMailRequested, Payload: mail}
+}
+
+// passwordChangedMail tells the user their password was changed, in case it wasn't them
+func passwordChangedMail(user *data.User) data.OutboxEvent {
+	var mail mailMessage
+	mail.From = "admin@example.com"
+	mail.To = user.Email
+	mail.Subject = "Your password was changed"
+	mail.Message = "Hello,\n the password of your LCS2 account was just changed.\n If it wasn't you, reset it right away and tell an administrator."
+
+	return mailEvent(mail)
+}
+
+// outboxRetryDelay returns how long to wait before trying a message again after its attempt-th failure
+func outboxRetryDelay(attempt int) time.Duration {
+	delay := outboxRetryBase
+	for i := 1; i < attempt && delay < outboxRetryMax; i++ {
+		delay *= 2
+	}
+
+	if delay > outboxRetryMax {
+		delay = outboxRetryMax
+	}
+
+	return delay
+}
+
+// relayOutbox delivers the messages of the outbox, one at a time, for as long as the service
+// runs. A message is marked delivered only once it was accepted, so it's delivered at least
+// once, maybe more.
+func (app *Config) relayOutbox() {
+	for {
+		message, err := app.Models.Outbox.Claim(outboxLease)
+		if err != nil {
+			log.Printf("outbox relay: can't claim a message: %s", err)
+			time.Sleep(outboxPollInterval)
+			continue
+		}
+
+		if message == nil {
+			time.Sleep(outboxPollInterval)
+			continue
+		}
+
+		app.relay(message)
+	}
+}
+
+// relay makes one attempt at delivering message and records how it went
+func (app *Config) relay(message *data.OutboxMessage) {
+	err := app.deliverOutboxMessage(message)
+	if err == nil {
+		if err := app.Models.Outbox.MarkDelivered(message); err != nil {
+			log.Printf("outbox relay: can't mark message %d delivered: %s", message.ID, err)
+		}
+		return
+	}
+
+	retryAt := time.Now().Add(outboxRetryDelay(message.Attempts))
+	if message.Attempts >= outboxMaxAttempts {
+		log.Printf("outbox relay: message %d (%s) failed %d times, giving up: %s",
+			message.ID, message.Topic, message.Attempts, err)
+	} else {
+		log.Printf("outbox relay: message %d (%s) failed %d times, retrying at %s: %s",
+			message.ID, message.Topic, message.Attempts, retryAt.Format(time.RFC3339), err)
+	}
+
+	if err := app.Models.Outbox.MarkFailed(message, outboxMaxAttempts, err.Error(), retryAt); err != nil {
+		log.Printf("outbox relay: can't record the failure of message %d: %s", message.ID, err)
+	}
+}
+
+// deliverOutboxMessage sends mail requests to the mail service, the entries of the audit trail
+// to the audit trail of the logger and the other events to the logger
+func (app *Config) deliverOutboxMessage(message *data.OutboxMessage) error {
+	switch message.Topic {
+	case data.TopicMailRequested:
+		var mail mailMessage
+		if err := json.Unmarshal(message.Payload, &mail); err != nil {
+			return err
+		}
+
+		return app.sendMail(mail)
+	case data.TopicAuditRecorded:
+		return postToLogger(auditServiceURL, message.Payload)
+	}
+
+	entry := struct {
+		Service string          `json:"service"`
+		Level   string          `json:"level"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+		Time    time.Time       `json:"time"`
+	}{
+		Service: "authentication",
+		Level:   "info",
+		Message: message.Topic,
+		Data:    message.Payload,
+		Time:    message.CreatedAt,
+	}
+
+	jsonData, _ := json.Marshal(entry)
+	return postToLogger(loggerServiceURL, jsonData)
+}
+
+// postToLogger sends the JSON body to url of the logger, which accepts what it stores
+func postToLogger(url string, body []byte) error {
+	request, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("logger service responded with %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// collectDeliveredOutbox periodically removes the messages delivered, or dead, more than outboxRetention ago
+func (app *Config) collectDeliveredOutbox(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := app.Models.Outbox.DeleteDeliveredBefore(time.Now().Add(-outboxRetention))
+		if err != nil {
+			log.Printf("outbox gc failed: %s", err)
+			continue
+		}
+
+		if removed > 0 {
+			log.Printf("outbox gc: removed %d delivered or dead messages", removed)
+		}
+	}
+}
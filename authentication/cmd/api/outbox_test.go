@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+func TestOutbox_RetryDelayBacksOff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{1, outboxRetryBase},
+		{2, 2 * outboxRetryBase},
+		{4, 8 * outboxRetryBase},
+		{100, outboxRetryMax},
+	}
+
+	for _, tt := range tests {
+		if delay := outboxRetryDelay(tt.attempt); delay != tt.delay {
+			t.Errorf("attempt %d: expected %s, got %s", tt.attempt, tt.delay, delay)
+		}
+	}
+}
+
+func TestOutbox_MailEventMatchesTheMailService(t *testing.T) {
+	event := passwordChangedMail(&data.User{Email: "jane@example.com"})
+	if event.Topic != data.TopicMailRequested {
+		t.Fatalf("expected topic %s, got %s", data.TopicMailRequested, event.Topic)
+	}
+
+	encoded, err := json.Marshal(event.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"from", "to", "subject", "message"} {
+		if fields[field] == "" {
+			t.Errorf("expected %s to be set in %s", field, encoded)
+		}
+	}
+	if fields["to"] != "jane@example.com" {
+		t.Errorf("expected the mail to go to the user, got %s", fields["to"])
+	}
+}
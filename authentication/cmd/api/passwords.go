@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// newPasswordPolicy reads the password policy from the environment:
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_CLASSES, PASSWORD_HISTORY and PASSWORD_MAX_AGE_DAYS
+func newPasswordPolicy() data.PasswordPolicy {
+	policy := data.PasswordPolicy{
+		MinLength:  10,
+		MinClasses: 3,
+		History:    5,
+	}
+
+	policy.MinLength = envInt("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MinClasses = envInt("PASSWORD_MIN_CLASSES", policy.MinClasses)
+	policy.History = envInt("PASSWORD_HISTORY", policy.History)
+	policy.MaxAge = time.Duration(envInt("PASSWORD_MAX_AGE_DAYS", 0)) * 24 * time.Hour
+
+	return policy
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Ignoring %s=%q, it isn't a number", name, value)
+		return fallback
+	}
+
+	return n
+}
+
+// rejectPassword checks a new password of the user against the policy and the passwords
+// the user had before. It writes the response and returns true when it can't be used.
+func (app *Config) rejectPassword(ctx *gin.Context, userID int, email, password string) bool {
+	if err := app.Passwords.Validate(password, email); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return true
+	}
+
+	reused, err := app.Models.User.PasswordReused(userID, password, app.Passwords.History)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return true
+	}
+
+	if reused {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "password was used recently, choose another one",
+		})
+		return true
+	}
+
+	return false
+}
+
+// pendingAction returns what the user must do before getting access tokens, or "" when nothing.
+// Such users only get a session to do it.
+func (app *Config) pendingAction(user *data.User) (string, error) {
+	if app.Passwords.Expired(user.PasswordChangeAt, time.Now()) {
+		return "Your password has expired, change it first", nil
+	}
+
+	missing, err := app.missingRequiredTOTP(user)
+	if err != nil || !missing {
+		return "", err
+	}
+
+	return "Two-factor authentication is required for your role, set it up first", nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows at most limit events per key within a sliding window
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (r *rateLimiter) Allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	recent := r.recent(key, now)
+
+	if len(recent) >= r.limit {
+		r.events[key] = recent
+		return false
+	}
+
+	r.events[key] = append(recent, now)
+	return true
+}
+
+// recent returns the events of key still inside the window, r.mu must be held
+func (r *rateLimiter) recent(key string, now time.Time) []time.Time {
+	events := r.events[key]
+
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= r.window {
+		i++
+	}
+
+	return events[i:]
+}
+
+// Forget drops the keys without events in the window, so the map doesn't keep growing
+func (r *rateLimiter) Forget() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key := range r.events {
+		if len(r.recent(key, now)) == 0 {
+			delete(r.events, key)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_AllowsUpToLimitPerKey(t *testing.T) {
+	limiter := newRateLimiter(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("a") {
+			t.Fatalf("event %d of a should be allowed", i+1)
+		}
+	}
+
+	if limiter.Allow("a") {
+		t.Errorf("fourth event of a should be limited")
+	}
+
+	if !limiter.Allow("b") {
+		t.Errorf("b has its own limit")
+	}
+}
+
+func TestRateLimiter_WindowSlides(t *testing.T) {
+	limiter := newRateLimiter(1, 20*time.Millisecond)
+
+	if !limiter.Allow("a") || limiter.Allow("a") {
+		t.Fatalf("only one event should be allowed in the window")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if !limiter.Allow("a") {
+		t.Errorf("event after the window should be allowed")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	limiter.Forget()
+
+	if len(limiter.events) != 0 {
+		t.Errorf("quiet keys should be forgotten")
+	}
+}
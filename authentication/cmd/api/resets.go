@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// how long the link in a reset email can be used
+const passwordResetLifetime = 30 * time.Minute
+
+// the page of the front-end the reset link opens, the token is appended to it
+var passwordResetURL = "http://localhost/reset-password?token="
+
+// reset requests are limited per client and per account, so the endpoint
+// can't be used to flood a mailbox
+var (
+	resetLimitByIP    = newRateLimiter(10, 15*time.Minute)
+	resetLimitByEmail = newRateLimiter(3, time.Hour)
+)
+
+func init() {
+	if os.Getenv("PASSWORD_RESET_URL") != "" {
+		passwordResetURL = os.Getenv("PASSWORD_RESET_URL")
+	}
+}
+
+// RequestPasswordReset emails a single-use reset link. The answer is the same
+// whether the account exists or not, so it can't be used to find accounts.
+func (app *Config) RequestPasswordReset(ctx *gin.Context) {
+	var requestPayload data.ForgotPasswordInput
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !resetLimitByIP.Allow(ctx.ClientIP()) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "true",
+			"message": "Too many reset requests, try again later",
+		})
+		return
+	}
+
+	email := strings.TrimSpace(requestPayload.Email)
+
+	// the mail is sent in the background so the response time doesn't tell whether the account exists
+	if resetLimitByEmail.Allow(strings.ToLower(email)) {
+		go app.sendPasswordReset(email)
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "If the account exists, a reset link has been sent to its email",
+	})
+}
+
+// sendPasswordReset creates a reset token for the account, its link is emailed once it's stored
+func (app *Config) sendPasswordReset(email string) {
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		return
+	}
+
+	token, err := data.NewResetToken()
+	if err != nil {
+		log.Printf("Can't create reset token for user %d: %s", user.ID, err)
+		return
+	}
+
+	var mail mailMessage
+	mail.From = "admin@example.com"
+	mail.To = user.Email
+	mail.Subject = "Reset password"
+	mail.Message = fmt.Sprintf("Hello,\n open %s%s to choose a new password.\n The link can be used once and expires in %d minutes.\n If you didn't ask for it, ignore this email.",
+		passwordResetURL, token, int(passwordResetLifetime.Minutes()))
+
+	if err := app.Models.PasswordReset.Insert(user.ID, token, passwordResetLifetime, mailEvent(mail)); err != nil {
+		log.Printf("Can't create reset token for user %d: %s", user.ID, err)
+	}
+}
+
+// ConfirmPasswordReset sets the new password of the account the reset token was sent to
+func (app *Config) ConfirmPasswordReset(ctx *gin.Context) {
+	var requestPayload data.ResetPasswordInput
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if requestPayload.Password != requestPayload.PasswordConfirm {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "Passwords don't match",
+		})
+		return
+	}
+
+	token := ctx.Param("token")
+
+	var user *data.User
+	userID, err := app.Models.PasswordReset.UserID(token)
+	if err == nil {
+		user, err = app.Models.User.GetOne(userID)
+		if err == nil {
+			if app.rejectPassword(ctx, user.ID, user.Email, requestPayload.Password) {
+				return
+			}
+			_, err = app.Models.PasswordReset.Consume(token, requestPayload.Password, passwordChangedMail(user))
+		}
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrResetTokenInvalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": "The reset link is invalid or has expired, please ask for a new one",
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	// whoever knew the old password is signed out everywhere
+	app.endSessions(user.Email)
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventPasswordReset,
+		Email: user.Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password changed, you can sign in with it now",
+	})
+}
+
+// collectExpiredResets periodically removes used and expired reset tokens
+// and the rate limits and sign-in failures of clients and emails that went quiet
+func (app *Config) collectExpiredResets(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		resetLimitByIP.Forget()
+		resetLimitByEmail.Forget()
+		verifyLimitByIP.Forget()
+
+		if forgotten, err := app.Models.LoginFailures.DeleteStale(loginFailureMemory); err != nil {
+			log.Printf("login failures gc failed: %s", err)
+		} else if forgotten > 0 {
+			log.Printf("login failures gc: removed %d stale emails", forgotten)
+		}
+
+		if forgotten, err := app.Models.IPLoginFailures.DeleteStale(ipFailureMemory); err != nil {
+			log.Printf("login failures gc failed: %s", err)
+		} else if forgotten > 0 {
+			log.Printf("login failures gc: removed %d stale IPs", forgotten)
+		}
+
+		removed, err := app.Models.PasswordReset.DeleteExpired()
+		if err != nil {
+			log.Printf("reset token gc failed: %s", err)
+			continue
+		}
+
+		if removed > 0 {
+			log.Printf("reset token gc: removed %d reset tokens", removed)
+		}
+	}
+}
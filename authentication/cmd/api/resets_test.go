@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResets_ConfirmEndsTheSessionsOfTheUser(t *testing.T) {
+	app, router := newTestApp()
+	router.POST("/resetpwd/:token", app.ConfirmPasswordReset)
+
+	userSession, err := app.startSession("user@example.com", "", "")
+	if err != nil {
+		t.Fatalf("startSession: %s", err)
+	}
+
+	rec := doRequest(router, "/resetpwd/reset-token", "",
+		`{"password": "Correct-Horse-9-Battery", "passwordConfirm": "Correct-Horse-9-Battery"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm reset: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(router, "/refresh", userSession.Token, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after reset: expected 401, got %d", rec.Code)
+	}
+}
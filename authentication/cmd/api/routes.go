@@ -6,9 +6,15 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
 )
 
-var webPort = "80"
+var (
+	webPort        = "80"
+	mailServiceURL = "http://host.docker.internal:9001/send"
+	// the mail service only queues mail sent with an API key issued for the mail scope
+	mailAPIKey string
+)
 
 const GROUP_AUTH_API = "/api/auth/"
 
@@ -28,24 +34,59 @@ func (app *Config) startApp() {
 	}))
 
 	router.GET("/heartbeat", app.HeartBeat)
+	router.GET("/.well-known/jwks.json", app.JWKS)
+	router.POST("/apikeys/verify", app.VerifyAPIKey)
 
 	// auth with middleware
 	authorized := router.Group("/")
-	authorized.Use(AuthMiddleWare())
+	authorized.Use(app.AuthMiddleWare())
 	{
 		// map to URL
 		authorized.POST("/signin", app.Signin)
 		authorized.POST("/upload", app.UpdateAvatar)
 		authorized.GET("/avatar/:email", app.GetAvatar)
-		authorized.POST("resetpwd", app.ResetPassword)
+		authorized.POST("/resetpwd", app.RequestPasswordReset)
+		authorized.POST("/resetpwd/:token", app.ConfirmPasswordReset)
+		authorized.POST("/invitation/:token", app.AcceptInvitation)
+		authorized.POST("/signin/2fa", app.SigninTOTP)
+		authorized.POST("/2fa/setup", app.SetupTOTP)
+		authorized.POST("/2fa/confirm", app.ConfirmTOTP)
+		authorized.POST("/2fa/recovery-codes", app.RegenerateRecoveryCodes)
+		authorized.DELETE("/2fa", app.DisableTOTP)
+		authorized.GET("/2fa/roles", app.RequirePermission(data.PermUsersRead), app.ListTOTPRoles)
+		authorized.PUT("/2fa/roles/:role", app.RequirePermission(data.PermRolesWrite), app.SetTOTPRole)
 
 		authorized.POST("/logout", app.Logout)
+		authorized.GET("/sessions", app.ListSessions)
+		authorized.DELETE("/sessions", app.RevokeOtherSessions)
+		authorized.DELETE("/session/:id", app.RevokeSession)
+		authorized.DELETE("/user/:email/sessions", app.RequirePermission(data.PermUsersWrite), app.RevokeUserSessions)
 		authorized.POST("/refresh", app.Refresh)
 		authorized.POST("/changepwd", app.ChangePassword)
-		authorized.POST("/adduser", app.AddUser)
-		authorized.GET("/listusers", app.ListAllUsers)
+		authorized.POST("/adduser", app.RequirePermission(data.PermUsersWrite), app.AddUser)
+		authorized.POST("/user/:email/invitation", app.RequirePermission(data.PermUsersWrite), app.ResendInvitation)
+		authorized.POST("/user/:email/unlock", app.RequirePermission(data.PermUsersWrite), app.UnlockUser)
+		authorized.GET("/audit", app.RequirePermission(data.PermAuditRead), app.ListAudit)
+		authorized.GET("/listusers", app.RequirePermission(data.PermUsersRead), app.ListAllUsers)
+		authorized.GET("/roles", app.RequirePermission(data.PermUsersRead), app.ListRoles)
+		authorized.PUT("/user/:email/role", app.RequirePermission(data.PermRolesWrite), app.SetUserRole)
+		authorized.PUT("/profile", app.UpdateProfile)
+		authorized.PUT("/user/:email", app.RequirePermission(data.PermUsersWrite), app.UpdateUser)
+		authorized.POST("/user/:email/deactivate", app.RequirePermission(data.PermUsersWrite), app.DeactivateUser)
+		authorized.POST("/user/:email/reactivate", app.RequirePermission(data.PermUsersWrite), app.ReactivateUser)
+		authorized.DELETE("/user/:email", app.RequirePermission(data.PermUsersWrite), app.DeleteUser)
+
+		authorized.GET("/apikeys", app.RequirePermission(data.PermAPIKeys), app.ListAPIKeys)
+		authorized.POST("/apikeys", app.RequirePermission(data.PermAPIKeys), app.CreateAPIKey)
+		authorized.DELETE("/apikey/:id", app.RequirePermission(data.PermAPIKeys), app.RevokeAPIKey)
+		authorized.POST("/apikey/:id/rotate", app.RequirePermission(data.PermAPIKeys), app.RotateAPIKey)
 		authorized.GET("/user/:email", app.GetUser)
+		authorized.GET("/whoami", app.WhoAmI)
+
+	}
 
+	if os.Getenv("MAIL_SERVICE_URL") != "" {
+		mailServiceURL = os.Getenv("MAIL_SERVICE_URL")
 	}
 
 	if os.Getenv("AUTH_PORT") != "" {
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+const (
+	// how long a session stays valid after sign in or refresh
+	sessionLifetime = 30 * 24 * time.Hour
+	// how often expired sessions are removed from the session store
+	sessionGCInterval = 10 * time.Minute
+	// how often the last use of a session is written, not on every request
+	sessionTouchInterval = time.Minute
+)
+
+var (
+	errSessionExpired  = errors.New("session expired")
+	errAccountInactive = errors.New("account is not active")
+)
+
+// newSessionStore picks the session backend from SESSION_STORE. Postgres is the default,
+// "memory" keeps sessions in process and is only meant for tests and local runs.
+func newSessionStore() data.SessionStore {
+	switch os.Getenv("SESSION_STORE") {
+	case "memory":
+		log.Println("Using in-memory session store")
+		return data.NewMemorySessionStore()
+	default:
+		return data.NewPostgresSessionStore()
+	}
+}
+
+// startSession creates and stores a new session for username signing in from ip with userAgent
+func (app *Config) startSession(username, ip, userAgent string) (*data.Session, error) {
+	now := time.Now()
+	userSession := data.Session{
+		ID:         uuid.NewString(),
+		Token:      uuid.NewString(),
+		Username:   username,
+		Expiry:     now.Add(sessionLifetime),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		IP:         ip,
+		UserAgent:  userAgent,
+	}
+
+	err := app.Sessions.Save(userSession)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userSession, nil
+}
+
+// rotateSession replaces the token of current and extends it, used from ip. It fails with
+// data.ErrSessionNotFound if current has already been rotated or logged out.
+func (app *Config) rotateSession(current *data.Session, ip string) (*data.Session, error) {
+	now := time.Now()
+	next := *current
+	next.Token = uuid.NewString()
+	next.Expiry = now.Add(sessionLifetime)
+	next.LastSeenAt = now
+	next.IP = ip
+
+	err := app.Sessions.Rotate(current.Token, next)
+	if err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+// endSessions signs username out everywhere, failures are only logged since the
+// sessions of an inactive account are rejected anyway
+func (app *Config) endSessions(username string) {
+	if err := app.Sessions.DeleteByUser(username); err != nil {
+		log.Printf("Can't remove the sessions of %s: %s", username, err)
+	}
+}
+
+// touchSession records the use of userSession from ip, at most every sessionTouchInterval
+func (app *Config) touchSession(userSession *data.Session, ip string) {
+	now := time.Now()
+	if now.Sub(userSession.LastSeenAt) < sessionTouchInterval && userSession.IP == ip {
+		return
+	}
+
+	if err := app.Sessions.Touch(userSession.Token, now, ip); err != nil {
+		log.Printf("Can't record the use of session %s: %s", userSession.ID, err)
+		return
+	}
+
+	userSession.LastSeenAt = now
+	userSession.IP = ip
+}
+
+// collectExpiredSessions removes expired sessions from the store every interval.
+// It never returns, so run it in its own goroutine.
+func (app *Config) collectExpiredSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := app.Sessions.DeleteExpired()
+		if err != nil {
+			log.Printf("session gc failed: %s", err)
+			continue
+		}
+
+		if removed > 0 {
+			log.Printf("session gc: removed %d expired sessions", removed)
+		}
+	}
+}
+
+// sessionView is a session as its owner sees it
+type sessionView struct {
+	data.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions returns where the signed-in user is signed in
+func (app *Config) ListSessions(ctx *gin.Context) {
+	userSession, err := app.validateSession(ctx)
+	if err != nil {
+		return
+	}
+
+	sessions, err := app.Sessions.List(userSession.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't read sessions"})
+		return
+	}
+
+	views := make([]sessionView, len(sessions))
+	for i, session := range sessions {
+		views[i] = sessionView{Session: session, Current: session.ID == userSession.ID}
+	}
+
+	ctx.JSON(http.StatusOK, views)
+}
+
+// RevokeSession signs the signed-in user out of one of their sessions
+func (app *Config) RevokeSession(ctx *gin.Context) {
+	userSession, err := app.validateSession(ctx)
+	if err != nil {
+		return
+	}
+
+	err = app.Sessions.DeleteByID(userSession.Username, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrSessionNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error":   "true",
+				"message": "Session not found",
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't remove session"})
+		return
+	}
+
+	if ctx.Param("id") == userSession.ID {
+		http.SetCookie(ctx.Writer, &http.Cookie{
+			Name:     SESSION_TOKEN,
+			Value:    "",
+			Expires:  time.Now(),
+			SameSite: http.SameSiteDefaultMode,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions signs the signed-in user out everywhere but here
+func (app *Config) RevokeOtherSessions(ctx *gin.Context) {
+	userSession, err := app.validateSession(ctx)
+	if err != nil {
+		return
+	}
+
+	if err := app.Sessions.DeleteOthers(userSession.Username, userSession.Token); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't remove sessions"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Signed out of every other session"})
+}
+
+// RevokeUserSessions lets an admin sign a user out everywhere, e.g. when the account is compromised
+func (app *Config) RevokeUserSessions(ctx *gin.Context) {
+	email := ctx.Param("email")
+
+	if err := app.Sessions.DeleteByUser(email); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't remove sessions"})
+		return
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventSessionsRevoked,
+		Email: email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("User %s signed out everywhere", email),
+	})
+}
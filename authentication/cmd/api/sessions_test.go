@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+func newTestApp() (*Config, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	app := &Config{
+		Models:   data.New(openTestDB()),
+		Sessions: data.NewMemorySessionStore(),
+		Tokens:   newTokenIssuerWithKey(key),
+	}
+
+	router := gin.New()
+	router.POST("/signin", app.Signin)
+	router.POST("/refresh", app.Refresh)
+	router.POST("/logout", app.Logout)
+
+	return app, router
+}
+
+func doRequest(router *gin.Engine, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: SESSION_TOKEN, Value: token})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) string {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == SESSION_TOKEN {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func TestSessions_SigninRefreshLogoutConcurrently(t *testing.T) {
+	_, router := newTestApp()
+
+	const users = 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rec := doRequest(router, "/signin", "", `{"email": "user@example.com", "password": "`+testPassword+`"}`)
+			if rec.Code != http.StatusAccepted {
+				t.Errorf("signin: expected 202, got %d: %s", rec.Code, rec.Body)
+				return
+			}
+
+			token := sessionCookie(rec)
+			if token == "" {
+				t.Errorf("signin: no session cookie returned")
+				return
+			}
+
+			rec = doRequest(router, "/refresh", token, "")
+			if rec.Code != http.StatusOK {
+				t.Errorf("refresh: expected 200, got %d", rec.Code)
+				return
+			}
+
+			token = sessionCookie(rec)
+			if token == "" {
+				t.Errorf("refresh: no session cookie returned")
+				return
+			}
+
+			rec = doRequest(router, "/logout", token, `{"email": "user@example.com"}`)
+			if rec.Code != http.StatusOK {
+				t.Errorf("logout: expected 200, got %d", rec.Code)
+			}
+
+			rec = doRequest(router, "/refresh", token, "")
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("refresh after logout: expected 401, got %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSessions_ConcurrentRefreshOfOneToken(t *testing.T) {
+	app, router := newTestApp()
+
+	userSession, err := app.startSession("user@example.com", "", "")
+	if err != nil {
+		t.Fatalf("startSession: %s", err)
+	}
+
+	const workers = 20
+
+	var refreshed int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rec := doRequest(router, "/refresh", userSession.Token, "")
+			switch rec.Code {
+			case http.StatusOK:
+				atomic.AddInt32(&refreshed, 1)
+			case http.StatusUnauthorized:
+			default:
+				t.Errorf("refresh: unexpected status %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if refreshed != 1 {
+		t.Errorf("expected exactly one successful refresh, got %d", refreshed)
+	}
+}
+
+func TestSessions_LogoutRequiresOwnSession(t *testing.T) {
+	app, router := newTestApp()
+
+	userSession, err := app.startSession("user@example.com", "", "")
+	if err != nil {
+		t.Fatalf("startSession: %s", err)
+	}
+
+	rec := doRequest(router, "/logout", userSession.Token, `{"email": "someone@example.com"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+
+	if _, err := app.Sessions.Get(userSession.Token); err != nil {
+		t.Errorf("session should still exist: %s", err)
+	}
+}
+
+func TestSessions_InactiveAccountSignedOut(t *testing.T) {
+	app, router := newTestApp()
+
+	first, _ := app.startSession("inactive@example.com", "", "")
+	second, _ := app.startSession("inactive@example.com", "", "")
+
+	rec := doRequest(router, "/refresh", first.Token, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh of a deactivated account: expected 401, got %d", rec.Code)
+	}
+
+	if _, err := app.Sessions.Get(second.Token); err != data.ErrSessionNotFound {
+		t.Errorf("every session of a deactivated account should be removed, got %v", err)
+	}
+}
+
+func TestSessions_ExpireAfterThirtyDays(t *testing.T) {
+	app, _ := newTestApp()
+
+	before := time.Now()
+	userSession, err := app.startSession("user@example.com", "", "")
+	if err != nil {
+		t.Fatalf("startSession: %s", err)
+	}
+	after := time.Now()
+
+	if userSession.Expiry.Before(before.Add(30*24*time.Hour)) || userSession.Expiry.After(after.Add(30*24*time.Hour)) {
+		t.Errorf("session started at %s expires at %s, want 30 days later", before, userSession.Expiry)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// usersDriver is a database/sql driver that answers the user lookups of the
+// handlers with an active admin for any email or id, so handler tests don't need Postgres.
+// Emails starting with "inactive" get a deactivated user. Every user signs in with
+// testPassword, without a second factor or failed sign-ins, from any IP. Every reset token
+// belongs to user@example.com, who has no password history.
+type usersDriver struct{}
+
+const testPassword = "correct horse battery staple"
+
+var (
+	testPasswordHash     []byte
+	testPasswordHashOnce sync.Once
+)
+
+func passwordHash() string {
+	testPasswordHashOnce.Do(func() {
+		testPasswordHash, _ = bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	})
+	return string(testPasswordHash)
+}
+
+func init() {
+	sql.Register("testusers", usersDriver{})
+}
+
+func openTestDB() *sql.DB {
+	db, _ := sql.Open("testusers", "")
+	return db
+}
+
+func (usersDriver) Open(string) (driver.Conn, error) { return usersConn{}, nil }
+
+type usersConn struct{}
+
+func (usersConn) Prepare(query string) (driver.Stmt, error) { return usersStmt{query: query}, nil }
+func (usersConn) Close() error                              { return nil }
+func (usersConn) Begin() (driver.Tx, error)                 { return usersTx{}, nil }
+
+type usersTx struct{}
+
+func (usersTx) Commit() error   { return nil }
+func (usersTx) Rollback() error { return nil }
+
+type usersStmt struct{ query string }
+
+func (usersStmt) Close() error  { return nil }
+func (usersStmt) NumInput() int { return -1 }
+
+func (usersStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+
+func (s usersStmt) Query(args []driver.Value) (driver.Rows, error) {
+	// no role requires a second factor
+	if strings.Contains(s.query, "from totp_required_roles") {
+		return &usersRows{columns: []string{"exists"}, row: []driver.Value{false}}, nil
+	}
+
+	if strings.Contains(s.query, "from ip_login_failures") {
+		return &usersRows{columns: []string{"failures", "last_failure_at"}, done: true}, nil
+	}
+
+	if strings.Contains(s.query, "from login_failures") {
+		return &usersRows{columns: []string{"failures", "last_failure_at", "locked_until"}, done: true}, nil
+	}
+
+	if strings.Contains(s.query, "from user_totp") {
+		return &usersRows{columns: []string{"secret", "last_step", "confirmed_at", "created_at"}, done: true}, nil
+	}
+
+	if strings.Contains(s.query, "password_history") {
+		return &usersRows{columns: []string{"password"}, done: true}, nil
+	}
+
+	if strings.Contains(s.query, "password_resets") {
+		return &usersRows{columns: []string{"user_id"}, row: []driver.Value{int64(1)}}, nil
+	}
+
+	email := driver.Value("user@example.com")
+	switch {
+	case strings.Contains(s.query, "from users where email") && len(args) == 1:
+		email = args[0]
+	case strings.Contains(s.query, "from users where id") && len(args) == 1:
+	default:
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+
+	now := time.Now()
+	active, deactivatedAt := int64(1), driver.Value(nil)
+	if address, _ := email.(string); strings.HasPrefix(address, "inactive") {
+		active, deactivatedAt = 0, now
+	}
+
+	return &usersRows{columns: userColumns, row: []driver.Value{
+		int64(1), email, "Test", "User", passwordHash(), active, "admin", now, now, now, now, deactivatedAt,
+	}}, nil
+}
+
+var userColumns = []string{"id", "email", "first_name", "last_name", "password", "user_active", "role",
+	"last_login", "password_changed_at", "created_at", "updated_at", "deactivated_at"}
+
+type usersRows struct {
+	columns []string
+	row     []driver.Value
+	done    bool
+}
+
+func (r *usersRows) Columns() []string { return r.columns }
+
+func (r *usersRows) Close() error { return nil }
+
+func (r *usersRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// access tokens are short-lived, the session cookie is used to get a new one through /refresh
+const accessTokenLifetime = 15 * time.Minute
+
+// the issuer other services expect in the access tokens
+const tokenIssuer = "lcs2-authentication"
+
+// devMode reports whether the service runs on a developer machine, where the keys it signs
+// with may be generated at startup. It is turned on with AUTH_DEV_MODE=true.
+func devMode() bool {
+	return os.Getenv("AUTH_DEV_MODE") == "true"
+}
+
+// secretFromEnv returns the value of the environment variable name, or else the content of
+// the file named by name_FILE, which is how compose hands secrets to the service
+func secretFromEnv(name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading %s_FILE: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// AccessClaims is what an access token tells other services about the signed-in user
+type AccessClaims struct {
+	Email     string   `json:"email"`
+	FirstName string   `json:"first_name,omitempty"`
+	LastName  string   `json:"last_name,omitempty"`
+	Roles     []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer signs access tokens with an RSA key and publishes its public half as a JWKS
+type TokenIssuer struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// newTokenIssuer loads the signing key from the PEM in JWT_PRIVATE_KEY, or in the file
+// named by JWT_PRIVATE_KEY_FILE. Every replica must sign with the same key, so a missing key
+// is an error, unless in dev mode where a key is generated and tokens don't survive a restart.
+func newTokenIssuer() (*TokenIssuer, error) {
+	var key *rsa.PrivateKey
+
+	pemKey, err := secretFromEnv("JWT_PRIVATE_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case pemKey != "":
+		block, _ := pem.Decode([]byte(pemKey))
+		if block == nil {
+			return nil, errors.New("JWT_PRIVATE_KEY is not PEM encoded")
+		}
+
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("JWT_PRIVATE_KEY is not an RSA key")
+		}
+		key = rsaKey
+	case devMode():
+		log.Println("JWT_PRIVATE_KEY is not set, generating a signing key for dev mode")
+
+		generated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key = generated
+	default:
+		return nil, errors.New("JWT_PRIVATE_KEY is not set")
+	}
+
+	return newTokenIssuerWithKey(key), nil
+}
+
+func newTokenIssuerWithKey(key *rsa.PrivateKey) *TokenIssuer {
+	// the key id is derived from the public key, so every replica signing with the same key agrees on it
+	der := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+
+	return &TokenIssuer{
+		key:   key,
+		keyID: base64.RawURLEncoding.EncodeToString(sum[:12]),
+	}
+}
+
+// Issue signs a new access token for user
+func (t *TokenIssuer) Issue(user *data.User) (string, time.Time, error) {
+	now := time.Now()
+	expiry := now.Add(accessTokenLifetime)
+
+	claims := AccessClaims{
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Roles:     []string{user.Role},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiry),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = t.keyID
+
+	signed, err := token.SignedString(t.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiry, nil
+}
+
+// JSONWebKey is the public signing key in the format of RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS returns the key set other services verify access tokens with
+func (t *TokenIssuer) JWKS() map[string][]JSONWebKey {
+	public := t.key.PublicKey
+
+	return map[string][]JSONWebKey{
+		"keys": {
+			{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: "RS256",
+				Kid: t.keyID,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			},
+		},
+	}
+}
+
+// tokens for one purpose that only this service reads, like invitation links, are signed
+// with TOKEN_SECRET, loaded at startup by loadTokenSecret
+var tokenSecret []byte
+
+// loadTokenSecret reads TOKEN_SECRET, or the file named by TOKEN_SECRET_FILE. Every replica
+// must share it, so a missing secret is an error, unless in dev mode where one is generated
+// and the tokens don't survive a restart.
+func loadTokenSecret() error {
+	secret, err := secretFromEnv("TOKEN_SECRET")
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case secret != "":
+		tokenSecret = []byte(secret)
+	case devMode():
+		log.Println("TOKEN_SECRET is not set, generating one for dev mode")
+
+		tokenSecret = make([]byte, 32)
+		if _, err := rand.Read(tokenSecret); err != nil {
+			return err
+		}
+	default:
+		return errors.New("TOKEN_SECRET is not set")
+	}
+
+	return nil
+}
+
+// signPurposeToken signs claims with tokenSecret for the given audience
+func signPurposeToken(audience string, claims jwt.RegisteredClaims) (string, error) {
+	claims.Issuer = tokenIssuer
+	claims.Audience = jwt.ClaimStrings{audience}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tokenSecret)
+}
+
+// parsePurposeToken checks the signature, lifetime and audience of a token made by signPurposeToken
+func parsePurposeToken(audience, token string) (*jwt.RegisteredClaims, error) {
+	var claims jwt.RegisteredClaims
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+		return tokenSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyAudience(audience, true) {
+		return nil, fmt.Errorf("token is not meant for %s", audience)
+	}
+
+	return &claims, nil
+}
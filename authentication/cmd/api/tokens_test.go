@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func init() {
+	// main loads it from the environment
+	tokenSecret = []byte("test token secret")
+}
+
+func TestTokens_RefreshIssuesTokenVerifiableWithJWKS(t *testing.T) {
+	app, router := newTestApp()
+
+	userSession, err := app.startSession("user@example.com", "", "")
+	if err != nil {
+		t.Fatalf("startSession: %s", err)
+	}
+
+	rec := doRequest(router, "/refresh", userSession.Token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d", rec.Code)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.AccessToken == "" {
+		t.Fatalf("refresh: no access token in %s", rec.Body.String())
+	}
+
+	// rebuild the public key from the JWKS, the way other services do
+	jwk := app.Tokens.JWKS()["keys"][0]
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	var claims AccessClaims
+	token, err := jwt.ParseWithClaims(response.AccessToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != jwk.Kid {
+			t.Errorf("expected kid %s, got %v", jwk.Kid, token.Header["kid"])
+		}
+		return public, nil
+	})
+	if err != nil || !token.Valid {
+		t.Fatalf("access token doesn't verify: %s", err)
+	}
+
+	if claims.Email != "user@example.com" || claims.Subject != "1" || claims.Issuer != tokenIssuer {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+		t.Errorf("expected roles [admin], got %v", claims.Roles)
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+const (
+	// the name authenticator apps show next to the account
+	totpIssuerName = "LCS2"
+	// codes of the time steps around the current one are accepted, for clocks that drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	// how long the password of a sign-in stays good for while the second factor is entered
+	mfaChallengeLifetime = 5 * time.Minute
+	mfaAudience          = "lcs2-mfa"
+)
+
+var errInvalidCode = errors.New("invalid code")
+
+// signMFAChallenge returns the token proving that user already gave the right password
+func signMFAChallenge(user *data.User) (string, error) {
+	now := time.Now()
+
+	return signPurposeToken(mfaAudience, jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(user.ID),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeLifetime)),
+	})
+}
+
+// totpStep returns the time step of code when it's valid for secret around now
+func totpStep(secret, code string, now time.Time) (int64, bool) {
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		at := now.Add(time.Duration(skew) * 30 * time.Second)
+
+		expected, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+			Period:    30,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / 30, true
+		}
+	}
+
+	return 0, false
+}
+
+// checkTOTPCode accepts a code of the authenticator app of the user once
+func (app *Config) checkTOTPCode(secondFactor *data.TOTP, code string) error {
+	step, ok := totpStep(secondFactor.Secret, code, time.Now())
+	if !ok {
+		return errInvalidCode
+	}
+
+	err := app.Models.TOTP.UseStep(secondFactor.UserID, step)
+	if errors.Is(err, data.ErrTOTPCodeReused) {
+		return errInvalidCode
+	}
+
+	return err
+}
+
+// checkSecondFactor accepts either a code of the authenticator app or an unused recovery code
+func (app *Config) checkSecondFactor(secondFactor *data.TOTP, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		used, err := app.Models.TOTP.UseRecoveryCode(secondFactor.UserID, recoveryCode)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidCode
+		}
+		return nil
+	}
+
+	return app.checkTOTPCode(secondFactor, code)
+}
+
+// missingRequiredTOTP reports whether the role of user requires a second factor the user hasn't set up
+func (app *Config) missingRequiredTOTP(user *data.User) (bool, error) {
+	required, err := app.Models.TOTP.Required(user.Role)
+	if err != nil || !required {
+		return false, err
+	}
+
+	secondFactor, err := app.Models.TOTP.Get(user.ID)
+	if errors.Is(err, data.ErrTOTPNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !secondFactor.Enabled(), nil
+}
+
+// generateRecoveryCodes returns new single-use codes formatted like ABCDE-FGHIJ
+func generateRecoveryCodes() ([]string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+
+	return codes, nil
+}
+
+// sessionUser returns the user of the session of the request, it answers and returns nil otherwise
+func (app *Config) sessionUser(ctx *gin.Context) *data.User {
+	userSession, err := app.validateSession(ctx)
+	if err != nil {
+		return nil
+	}
+
+	user, err := app.Models.User.GetByEmail(userSession.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil
+	}
+
+	return user
+}
+
+// bindCode reads the code of the authenticator app or a recovery code from the request
+func bindCode(ctx *gin.Context) (string, string, bool) {
+	var requestPayload struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return "", "", false
+	}
+
+	if requestPayload.Code == "" && requestPayload.RecoveryCode == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "code or recovery_code is required",
+		})
+		return "", "", false
+	}
+
+	return requestPayload.Code, requestPayload.RecoveryCode, true
+}
+
+// SetupTOTP starts the enrollment of an authenticator app, it has to be confirmed with a code
+func (app *Config) SetupTOTP(ctx *gin.Context) {
+	user := app.sessionUser(ctx)
+	if user == nil {
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuerName,
+		AccountName: user.Email,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't generate secret"})
+		return
+	}
+
+	err = app.Models.TOTP.Begin(user.ID, key.Secret())
+	if err != nil {
+		if errors.Is(err, data.ErrTOTPAlreadyActive) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": "Two-factor authentication is already enabled, disable it first",
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	var qrCode bytes.Buffer
+	image, err := key.Image(256, 256)
+	if err == nil {
+		err = png.Encode(&qrCode, image)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't render QR code"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":           "success",
+		"message":          "Scan the QR code with your authenticator app, then confirm with a code",
+		"secret":           key.Secret(),
+		"provisioning_uri": key.URL(),
+		"qr_code":          "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode.Bytes()),
+	})
+}
+
+// ConfirmTOTP enables the second factor once the user shows a code of the app, and returns the recovery codes
+func (app *Config) ConfirmTOTP(ctx *gin.Context) {
+	user := app.sessionUser(ctx)
+	if user == nil {
+		return
+	}
+
+	code, _, ok := bindCode(ctx)
+	if !ok {
+		return
+	}
+
+	secondFactor, err := app.Models.TOTP.Get(user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrTOTPNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Set up two-factor authentication first"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if secondFactor.Enabled() {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	if err := app.checkTOTPCode(secondFactor, code); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "Invalid code",
+		})
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't generate recovery codes"})
+		return
+	}
+
+	if err := app.Models.TOTP.Confirm(user.ID, codes); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"message":        "Two-factor authentication enabled. Keep the recovery codes somewhere safe, each works once",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, the old ones stop working
+func (app *Config) RegenerateRecoveryCodes(ctx *gin.Context) {
+	user := app.sessionUser(ctx)
+	if user == nil {
+		return
+	}
+
+	code, recoveryCode, ok := bindCode(ctx)
+	if !ok {
+		return
+	}
+
+	secondFactor, ok := app.enabledSecondFactor(ctx, user)
+	if !ok {
+		return
+	}
+
+	if !app.secondFactorAccepted(ctx, secondFactor, code, recoveryCode) {
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Can't generate recovery codes"})
+		return
+	}
+
+	if err := app.Models.TOTP.ReplaceRecoveryCodes(user.ID, codes); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"message":        "New recovery codes created, the old ones don't work anymore",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP removes the second factor, unless the role of the user requires one
+func (app *Config) DisableTOTP(ctx *gin.Context) {
+	user := app.sessionUser(ctx)
+	if user == nil {
+		return
+	}
+
+	code, recoveryCode, ok := bindCode(ctx)
+	if !ok {
+		return
+	}
+
+	required, err := app.Models.TOTP.Required(user.Role)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if required {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error":   "true",
+			"message": "Two-factor authentication is required for your role",
+		})
+		return
+	}
+
+	secondFactor, ok := app.enabledSecondFactor(ctx, user)
+	if !ok {
+		return
+	}
+
+	if !app.secondFactorAccepted(ctx, secondFactor, code, recoveryCode) {
+		return
+	}
+
+	if err := app.Models.TOTP.Disable(user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// enabledSecondFactor returns the confirmed second factor of user, it answers and returns false otherwise
+func (app *Config) enabledSecondFactor(ctx *gin.Context, user *data.User) (*data.TOTP, bool) {
+	secondFactor, err := app.Models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrTOTPNotFound) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return nil, false
+	}
+
+	if !secondFactor.Enabled() {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "Two-factor authentication is not enabled"})
+		return nil, false
+	}
+
+	return secondFactor, true
+}
+
+// secondFactorAccepted checks a code or a recovery code, it answers and returns false when it's wrong
+func (app *Config) secondFactorAccepted(ctx *gin.Context, secondFactor *data.TOTP, code, recoveryCode string) bool {
+	err := app.checkSecondFactor(secondFactor, code, recoveryCode)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, errInvalidCode) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "Invalid code",
+		})
+		return false
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+	return false
+}
+
+// SigninTOTP is the second step of a sign-in with two-factor authentication
+func (app *Config) SigninTOTP(ctx *gin.Context) {
+	var requestPayload struct {
+		Challenge    string `json:"challenge" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	claims, err := parsePurposeToken(mfaAudience, requestPayload.Challenge)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in expired, please sign in again"})
+		return
+	}
+
+	userID, _ := strconv.Atoi(claims.Subject)
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil || user.Active != 1 {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in expired, please sign in again"})
+		return
+	}
+
+	// wrong codes count as failed sign-ins, so codes can't be guessed either
+	if !app.checkSigninAllowed(ctx, user.Email) {
+		return
+	}
+
+	secondFactor, err := app.Models.TOTP.Get(user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrTOTPNotFound) {
+			// disabled in the meantime, the password was checked already
+			app.completeSignin(ctx, user)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	err = app.checkSecondFactor(secondFactor, requestPayload.Code, requestPayload.RecoveryCode)
+	if err != nil {
+		if errors.Is(err, errInvalidCode) {
+			app.recordSigninFailure(ctx, user.Email)
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if requestPayload.RecoveryCode != "" {
+		log.Printf("User %d signed in with a recovery code", user.ID)
+	}
+
+	app.completeSignin(ctx, user)
+}
+
+// ListTOTPRoles returns the roles whose users must use a second factor
+func (app *Config) ListTOTPRoles(ctx *gin.Context) {
+	roles, err := app.Models.TOTP.RequiredRoles()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, roles)
+}
+
+// SetTOTPRole makes a second factor mandatory or optional for a role
+func (app *Config) SetTOTPRole(ctx *gin.Context) {
+	var requestPayload struct {
+		Required *bool `json:"required" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	role := ctx.Param("role")
+	if !data.ValidRole(role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("Unknown role %s", role),
+		})
+		return
+	}
+
+	if err := app.Models.TOTP.SetRequired(role, *requestPayload.Required); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	message := fmt.Sprintf("Two-factor authentication is optional for %s", role)
+	if *requestPayload.Required {
+		message = fmt.Sprintf("Two-factor authentication is required for %s", role)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+func TestTOTP_StepAcceptsDriftingClocks(t *testing.T) {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuerName, AccountName: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := totp.GenerateCode(key.Secret(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := totpStep(key.Secret(), code, now)
+	if !ok || step != now.Unix()/30 {
+		t.Errorf("expected step %d, got %d (ok %v)", now.Unix()/30, step, ok)
+	}
+
+	if _, ok := totpStep(key.Secret(), code, now.Add(30*time.Second)); !ok {
+		t.Errorf("code of the previous step should be accepted")
+	}
+
+	if _, ok := totpStep(key.Secret(), code, now.Add(2*time.Minute)); ok {
+		t.Errorf("old code should be rejected")
+	}
+}
+
+func TestTOTP_RecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	typed := strings.ToLower(strings.Replace(codes[0], "-", " ", 1))
+	if data.NormalizeRecoveryCode(typed) != data.NormalizeRecoveryCode(codes[0]) {
+		t.Errorf("typed code %q should match %q", typed, codes[0])
+	}
+}
+
+func TestTOTP_ChallengeIsNotAnInvitation(t *testing.T) {
+	challenge, err := signMFAChallenge(&data.User{ID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := parsePurposeToken(mfaAudience, challenge)
+	if err != nil || claims.Subject != "3" {
+		t.Fatalf("challenge doesn't parse: %v", err)
+	}
+
+	if _, _, err := parseInvitation(challenge); err == nil {
+		t.Errorf("a challenge should not be accepted as an invitation")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/authentication/data"
+)
+
+// UpdateProfile lets the signed-in user change their own name
+func (app *Config) UpdateProfile(ctx *gin.Context) {
+	userSession, err := app.validateSession(ctx)
+	if err != nil {
+		return
+	}
+
+	var requestPayload struct {
+		FirstName string `json:"first_name" binding:"required"`
+		LastName  string `json:"last_name" binding:"required"`
+	}
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	user, err := app.Models.User.GetByEmail(userSession.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	before := *user
+	user.FirstName = strings.TrimSpace(requestPayload.FirstName)
+	user.LastName = strings.TrimSpace(requestPayload.LastName)
+
+	if err := user.Update(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.recordChange(data.AuthEvent{
+		Type:  data.EventUserUpdated,
+		Email: user.Email,
+		IP:    ctx.ClientIP(),
+	}, before, user)
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// UpdateUser lets an admin change the email and name of a user, fields left out are kept.
+// A new email signs the user out, sessions belong to the email they were started with.
+func (app *Config) UpdateUser(ctx *gin.Context) {
+	var requestPayload struct {
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+	}
+
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	email := ctx.Param("email")
+
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("User %s doesn't exist!", email)})
+		return
+	}
+
+	before := *user
+	newEmail := strings.TrimSpace(requestPayload.Email)
+	if newEmail != "" && newEmail != user.Email {
+		if _, err := app.Models.User.GetByEmail(newEmail); err == nil {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": fmt.Sprintf("User %s already exists", newEmail),
+			})
+			return
+		}
+		user.Email = newEmail
+	}
+	if requestPayload.FirstName != "" {
+		user.FirstName = strings.TrimSpace(requestPayload.FirstName)
+	}
+	if requestPayload.LastName != "" {
+		user.LastName = strings.TrimSpace(requestPayload.LastName)
+	}
+
+	if err := user.Update(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if user.Email != email {
+		app.endSessions(email)
+	}
+
+	app.recordChange(data.AuthEvent{
+		Type:  data.EventUserUpdated,
+		Email: user.Email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	}, before, user)
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// userToManage returns the user of the :email parameter, or writes the response and returns nil
+// when it doesn't exist or is the admin making the request, who can't lock themselves out
+func (app *Config) userToManage(ctx *gin.Context) *data.User {
+	email := ctx.Param("email")
+
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("User %s doesn't exist!", email)})
+		return nil
+	}
+
+	if user.ID == currentUser(ctx).ID {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "You can't deactivate or delete your own account",
+		})
+		return nil
+	}
+
+	return user
+}
+
+// DeactivateUser stops a user from signing in and ends their sessions
+func (app *Config) DeactivateUser(ctx *gin.Context) {
+	user := app.userToManage(ctx)
+	if user == nil {
+		return
+	}
+
+	changed, err := app.Models.User.Deactivate(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if !changed {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("User %s is already deactivated", user.Email),
+		})
+		return
+	}
+
+	app.endSessions(user.Email)
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventUserDeactivated,
+		Email: user.Email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("User %s deactivated", user.Email),
+	})
+}
+
+// ReactivateUser lets a deactivated user sign in again
+func (app *Config) ReactivateUser(ctx *gin.Context) {
+	email := ctx.Param("email")
+
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("User %s doesn't exist!", email)})
+		return
+	}
+
+	changed, err := app.Models.User.Reactivate(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if !changed {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("User %s is not deactivated", email),
+		})
+		return
+	}
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventUserReactivated,
+		Email: email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("User %s reactivated", email),
+	})
+}
+
+// DeleteUser soft-deletes a user, the account disappears but its row is kept
+func (app *Config) DeleteUser(ctx *gin.Context) {
+	user := app.userToManage(ctx)
+	if user == nil {
+		return
+	}
+
+	if err := app.Models.User.SoftDelete(user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.endSessions(user.Email)
+
+	app.recordEvent(data.AuthEvent{
+		Type:  data.EventUserDeleted,
+		Email: user.Email,
+		Actor: currentUser(ctx).Email,
+		IP:    ctx.ClientIP(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("User %s deleted", user.Email),
+	})
+}
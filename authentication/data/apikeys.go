@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// the services an API key can be scoped to
+const (
+	ScopeAuthentication = "authentication"
+	ScopeEnrollment     = "enrollment"
+	ScopeMail           = "mail"
+)
+
+// the number of leading characters of a key kept in clear to tell keys apart
+const apiKeyPrefixLength = 8
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a key issued to one client application. Only the SHA-256 of the key
+// is stored, the key itself is shown once when it's created or rotated.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ValidScope reports whether scope is a service API keys can be issued for
+func ValidScope(scope string) bool {
+	return scope == ScopeAuthentication || scope == ScopeEnrollment || scope == ScopeMail
+}
+
+// HashToken returns how a key or a token is stored, they are random enough for a plain SHA-256
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey generates a random key
+func newAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Allows reports whether the key may be used against the service scope at now
+func (k *APIKey) Allows(scope string, now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return false
+	}
+
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+const apiKeyColumns = `id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
+
+// Insert issues a new key for a client application and returns it with the key in clear
+func (k *APIKey) Insert(apiKey APIKey) (*APIKey, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	secret, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	stmt := `insert into api_keys (name, prefix, key_hash, scopes, expires_at, created_at)
+	values ($1, $2, $3, $4, $5, $6) returning ` + apiKeyColumns
+
+	row := db.QueryRowContext(ctx, stmt,
+		apiKey.Name,
+		secret[:apiKeyPrefixLength],
+		HashToken(secret),
+		strings.Join(apiKey.Scopes, ","),
+		apiKey.ExpiresAt,
+		time.Now(),
+	)
+
+	created, err := scanAPIKey(row)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return created, secret, nil
+}
+
+// All returns every key, revoked ones included
+func (k *APIKey) All() ([]*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + apiKeyColumns + ` from api_keys order by id`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetByKey returns the key matching the key in clear
+func (k *APIKey) GetByKey(secret string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + apiKeyColumns + ` from api_keys where key_hash = $1`
+
+	key, err := scanAPIKey(db.QueryRowContext(ctx, query, HashToken(secret)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return key, err
+}
+
+// Revoke stops a key from being accepted
+func (k *APIKey) Revoke(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update api_keys set revoked_at = $1 where id = $2 and revoked_at is null`
+
+	result, err := db.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Rotate replaces the key of a client application with a new one, the old key stops
+// working at once. The new key is returned in clear.
+func (k *APIKey) Rotate(id int) (*APIKey, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	secret, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	stmt := `update api_keys set prefix = $1, key_hash = $2, last_used_at = null
+	where id = $3 and revoked_at is null returning ` + apiKeyColumns
+
+	rotated, err := scanAPIKey(db.QueryRowContext(ctx, stmt, secret[:apiKeyPrefixLength], HashToken(secret), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rotated, secret, nil
+}
+
+// Touch records that the key was just used
+func (k *APIKey) Touch(id int, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update api_keys set last_used_at = $1 where id = $2`
+	_, err := db.ExecContext(ctx, stmt, now, id)
+
+	return err
+}
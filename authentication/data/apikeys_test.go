@@ -0,0 +1,46 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKey_Allows(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		key   APIKey
+		scope string
+		want  bool
+	}{
+		{"scoped", APIKey{Scopes: []string{ScopeEnrollment}}, ScopeEnrollment, true},
+		{"other scope", APIKey{Scopes: []string{ScopeEnrollment}}, ScopeAuthentication, false},
+		{"not expired yet", APIKey{Scopes: []string{ScopeAuthentication}, ExpiresAt: &future}, ScopeAuthentication, true},
+		{"expired", APIKey{Scopes: []string{ScopeAuthentication}, ExpiresAt: &past}, ScopeAuthentication, false},
+		{"revoked", APIKey{Scopes: []string{ScopeAuthentication}, RevokedAt: &past}, ScopeAuthentication, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.key.Allows(tt.scope, now); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestHashToken_DoesNotKeepTheKey(t *testing.T) {
+	key, err := newAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := HashToken(key)
+	if hash == key || len(hash) != 64 {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if HashToken(key) != hash {
+		t.Errorf("hash is not stable")
+	}
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// the events of the audit trail of the authentication service
+const (
+	EventSignin             = "signin"
+	EventSigninFailed       = "signin_failed"
+	EventLogout             = "logout"
+	EventAccountLocked      = "account_locked"
+	EventAccountUnlocked    = "account_unlocked"
+	EventPasswordChanged    = "password_changed"
+	EventPasswordReset      = "password_reset"
+	EventInvitationAccepted = "invitation_accepted"
+	EventUserAdded          = "user_added"
+	EventUserUpdated        = "user_updated"
+	EventRoleChanged        = "role_changed"
+	EventAvatarChanged      = "avatar_changed"
+	EventUserDeactivated    = "user_deactivated"
+	EventUserReactivated    = "user_reactivated"
+	EventUserDeleted        = "user_deleted"
+	EventSessionsRevoked    = "sessions_revoked"
+)
+
+// AuthEvent is a security relevant or data-changing event kept for auditing.
+// Email is the account the event is about, Actor who caused it when that's someone else.
+// Before and After are what changed, as they were before and after, each nil for something
+// created or removed. The logger keeps only the fields that differ.
+type AuthEvent struct {
+	Type   string
+	Email  string
+	Actor  string
+	IP     string
+	Detail string
+	Before interface{}
+	After  interface{}
+}
+
+// AuditRecorded is the payload of TopicAuditRecorded, an entry of the audit trail the logger
+// keeps for the whole stack
+type AuditRecorded struct {
+	Service string      `json:"service"`
+	Action  string      `json:"action"`
+	Actor   string      `json:"actor"`
+	Target  string      `json:"target"`
+	IP      string      `json:"ip"`
+	Detail  string      `json:"detail,omitempty"`
+	Before  interface{} `json:"before,omitempty"`
+	After   interface{} `json:"after,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// auditEntry returns the entry of the audit trail of event, which happened at now.
+// Events without an actor were caused by the user of the account.
+func auditEntry(event AuthEvent, now time.Time) AuditRecorded {
+	actor := event.Actor
+	if actor == "" {
+		actor = event.Email
+	}
+
+	return AuditRecorded{
+		Service: "authentication",
+		Action:  event.Type,
+		Actor:   actor,
+		Target:  "user/" + event.Email,
+		IP:      event.IP,
+		Detail:  event.Detail,
+		Before:  event.Before,
+		After:   event.After,
+		Time:    now,
+	}
+}
+
+// Record writes event to the outbox, the relay hands it to the audit trail of the logger
+func (e *AuthEvent) Record(event AuthEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	err = addToOutbox(ctx, tx, now, OutboxEvent{Topic: TopicAuditRecorded, Payload: auditEntry(event, now)})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
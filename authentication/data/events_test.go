@@ -0,0 +1,34 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditEntry(t *testing.T) {
+	now := time.Now()
+
+	entry := auditEntry(AuthEvent{
+		Type:   EventRoleChanged,
+		Email:  "user@example.com",
+		Actor:  "admin@example.com",
+		IP:     "10.0.0.1",
+		Before: map[string]string{"role": RoleStaff},
+		After:  map[string]string{"role": RoleAdmin},
+	}, now)
+
+	if entry.Service != "authentication" || entry.Action != EventRoleChanged || entry.Actor != "admin@example.com" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry.Target != "user/user@example.com" || entry.IP != "10.0.0.1" || !entry.Time.Equal(now) {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestAuditEntry_OwnAccount(t *testing.T) {
+	entry := auditEntry(AuthEvent{Type: EventSignin, Email: "user@example.com"}, time.Now())
+
+	if entry.Actor != "user@example.com" {
+		t.Errorf("expected the user to be the actor of their own sign in, got %q", entry.Actor)
+	}
+}
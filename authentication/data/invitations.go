@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInvitationInvalid = errors.New("invitation is invalid, accepted, replaced or expired")
+
+// Invitation lets a pending user choose their password and activates the account.
+// Only the latest invitation of a user can be accepted, and only once.
+type Invitation struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Insert creates an invitation for the user valid for ttl, replacing the pending ones sent before.
+// The events events returns for the new invitation, like the mail carrying its link, go to the outbox with it.
+func (i *Invitation) Insert(userID int, ttl time.Duration, events func(*Invitation) ([]OutboxEvent, error)) (*Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from invitations where user_id = $1 and accepted_at is null`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invitation := Invitation{
+		UserID:    userID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	stmt := `insert into invitations (user_id, expires_at, created_at) values ($1, $2, $3) returning id`
+	err = tx.QueryRowContext(ctx, stmt, invitation.UserID, invitation.ExpiresAt, invitation.CreatedAt).Scan(&invitation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	outgoing, err := events(&invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addToOutbox(ctx, tx, now, outgoing...); err != nil {
+		return nil, err
+	}
+
+	return &invitation, tx.Commit()
+}
+
+// Accept uses up the invitation, sets the password the invitee chose and activates the account
+func (i *Invitation) Accept(id, userID int, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var accepted int
+	stmt := `update invitations set accepted_at = $1
+	where id = $2 and user_id = $3 and accepted_at is null and expires_at > $1 returning id`
+	err = tx.QueryRowContext(ctx, stmt, now, id, userID).Scan(&accepted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvitationInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := setPassword(ctx, tx, userID, hashedPassword, now); err != nil {
+		return err
+	}
+
+	// a user deactivated or deleted while invited stays so
+	stmt = `update users set user_active = 1 where id = $1 and deactivated_at is null and deleted_at is null`
+	result, err := tx.ExecContext(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvitationInvalid
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// LoginFailures tracks the failed sign-ins of an email. Emails without an account
+// are tracked the same way, so lockouts don't tell which accounts exist.
+type LoginFailures struct {
+	Email         string     `json:"email"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// Locked reports whether sign-ins are refused at now
+func (l *LoginFailures) Locked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
+
+// Get returns the failures of email, an email without failures has none
+func (l *LoginFailures) Get(email string) (*LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	failures := LoginFailures{Email: strings.ToLower(email)}
+	var lockedUntil sql.NullTime
+
+	query := `select failures, last_failure_at, locked_until from login_failures where email = $1`
+	err := db.QueryRowContext(ctx, query, failures.Email).Scan(&failures.Failures, &failures.LastFailureAt, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &failures, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lockedUntil.Valid {
+		failures.LockedUntil = &lockedUntil.Time
+	}
+
+	return &failures, nil
+}
+
+// RecordFailure counts a failed sign-in of email. Failures older than forgetAfter
+// aren't counted anymore. lockFor returns for how long the new count locks the email,
+// zero leaves it unlocked.
+func (l *LoginFailures) RecordFailure(email string, forgetAfter time.Duration, lockFor func(failures int) time.Duration) (*LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	failures := LoginFailures{Email: strings.ToLower(email), LastFailureAt: now}
+
+	stmt := `insert into login_failures (email, failures, last_failure_at) values ($1, 1, $2)
+	on conflict (email) do update set
+		failures = case when login_failures.last_failure_at < $3 then 1 else login_failures.failures + 1 end,
+		last_failure_at = $2
+	returning failures`
+	err = tx.QueryRowContext(ctx, stmt, failures.Email, now, now.Add(-forgetAfter)).Scan(&failures.Failures)
+	if err != nil {
+		return nil, err
+	}
+
+	if duration := lockFor(failures.Failures); duration > 0 {
+		lockedUntil := now.Add(duration)
+		failures.LockedUntil = &lockedUntil
+
+		_, err = tx.ExecContext(ctx, `update login_failures set locked_until = $1 where email = $2`, lockedUntil, failures.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &failures, tx.Commit()
+}
+
+// Reset forgets the failures of email, after a successful sign-in or when an admin unlocks it
+func (l *LoginFailures) Reset(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `delete from login_failures where email = $1`, strings.ToLower(email))
+	return err
+}
+
+// DeleteStale removes the failures that aren't counted anymore, the ones older than
+// forgetAfter on emails that aren't locked, and returns how many
+func (l *LoginFailures) DeleteStale(forgetAfter time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `delete from login_failures
+	where last_failure_at < $1 and (locked_until is null or locked_until < $2)`
+	result, err := db.ExecContext(ctx, stmt, now.Add(-forgetAfter), now)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// IPLoginFailures tracks the failed sign-ins from a client IP, whatever the email. They are
+// kept in Postgres, so every replica of the service throttles the IP the same.
+type IPLoginFailures struct {
+	IP            string    `json:"ip"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+}
+
+// Get returns the failures of ip, an IP without failures has none
+func (l *IPLoginFailures) Get(ip string) (*IPLoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	failures := IPLoginFailures{IP: ip}
+
+	query := `select failures, last_failure_at from ip_login_failures where ip = $1`
+	err := db.QueryRowContext(ctx, query, ip).Scan(&failures.Failures, &failures.LastFailureAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &failures, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// RecordFailure counts a failed sign-in from ip. Failures older than forgetAfter aren't
+// counted anymore.
+func (l *IPLoginFailures) RecordFailure(ip string, forgetAfter time.Duration) (*IPLoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	failures := IPLoginFailures{IP: ip, LastFailureAt: now}
+
+	stmt := `insert into ip_login_failures (ip, failures, last_failure_at) values ($1, 1, $2)
+	on conflict (ip) do update set
+		failures = case when ip_login_failures.last_failure_at < $3 then 1 else ip_login_failures.failures + 1 end,
+		last_failure_at = $2
+	returning failures`
+	err := db.QueryRowContext(ctx, stmt, ip, now, now.Add(-forgetAfter)).Scan(&failures.Failures)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// DeleteStale removes the failures of the IPs that went quiet for forgetAfter, and returns
+// how many
+func (l *IPLoginFailures) DeleteStale(forgetAfter time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `delete from ip_login_failures where last_failure_at < $1`,
+		time.Now().Add(-forgetAfter))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
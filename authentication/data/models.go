@@ -23,7 +23,15 @@ func New(dbPool *sql.DB) Models {
 	db = dbPool
 
 	return Models{
-		User: User{},
+		User:            User{},
+		APIKey:          APIKey{},
+		PasswordReset:   PasswordReset{},
+		Invitation:      Invitation{},
+		LoginFailures:   LoginFailures{},
+		IPLoginFailures: IPLoginFailures{},
+		AuthEvent:       AuthEvent{},
+		TOTP:            TOTP{},
+		Outbox:          Outbox{},
 	}
 }
 
@@ -31,21 +39,31 @@ func New(dbPool *sql.DB) Models {
 // in this type is available to us throughout the application, anywhere that the
 // app variable is used, provided that the model is also added in the New function.
 type Models struct {
-	User User
+	User            User
+	APIKey          APIKey
+	PasswordReset   PasswordReset
+	Invitation      Invitation
+	LoginFailures   LoginFailures
+	IPLoginFailures IPLoginFailures
+	AuthEvent       AuthEvent
+	TOTP            TOTP
+	Outbox          Outbox
 }
 
 // User is the structure which holds one user from the database.
 type User struct {
-	ID               int       `json:"id"`
-	Email            string    `json:"email"`
-	FirstName        string    `json:"first_name,omitempty"`
-	LastName         string    `json:"last_name,omitempty"`
-	Password         string    `json:"-"`
-	Active           int       `json:"active"`
-	LastLogin        time.Time `json:"last_login"`
-	PasswordChangeAt time.Time `json:"password_changed_at"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               int        `json:"id"`
+	Email            string     `json:"email"`
+	FirstName        string     `json:"first_name,omitempty"`
+	LastName         string     `json:"last_name,omitempty"`
+	Password         string     `json:"-"`
+	Active           int        `json:"active"`
+	Role             string     `json:"role"`
+	LastLogin        time.Time  `json:"last_login"`
+	PasswordChangeAt time.Time  `json:"password_changed_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeactivatedAt    *time.Time `json:"deactivated_at,omitempty"`
 }
 
 // ? ForgotPasswordInput struct
@@ -77,8 +95,8 @@ func (u *User) GetAll() ([]*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, last_login, password_changed_at, created_at, updated_at
-	from users order by last_name`
+	query := `select id, email, first_name, last_name, password, user_active, role, last_login, password_changed_at, created_at, updated_at, deactivated_at
+	from users where deleted_at is null order by last_name`
 
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
@@ -98,10 +116,12 @@ func (u *User) GetAll() ([]*User, error) {
 			&user.LastName,
 			&user.Password,
 			&user.Active,
+			&user.Role,
 			&user.LastLogin,
 			&user.PasswordChangeAt,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.DeactivatedAt,
 		)
 		if err != nil {
 			log.Println("Error scanning", err)
@@ -119,7 +139,8 @@ func (u *User) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, last_login, password_changed_at, created_at, updated_at from users where email = $1`
+	query := `select id, email, first_name, last_name, password, user_active, role, last_login, password_changed_at, created_at, updated_at, deactivated_at
+	from users where email = $1 and deleted_at is null`
 
 	var user User
 	row := db.QueryRowContext(ctx, query, email)
@@ -131,10 +152,12 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
 		&user.LastLogin,
 		&user.PasswordChangeAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeactivatedAt,
 	)
 
 	if err != nil {
@@ -150,7 +173,8 @@ func (u *User) GetOne(id int) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, last_login, password_changed_at, created_at, updated_at from users where id = $1`
+	query := `select id, email, first_name, last_name, password, user_active, role, last_login, password_changed_at, created_at, updated_at, deactivated_at
+	from users where id = $1 and deleted_at is null`
 
 	var user User
 	row := db.QueryRowContext(ctx, query, id)
@@ -162,10 +186,12 @@ func (u *User) GetOne(id int) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
 		&user.LastLogin,
 		&user.PasswordChangeAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeactivatedAt,
 	)
 
 	if err != nil {
@@ -187,7 +213,7 @@ func (u *User) Update() error {
 		last_name = $3,
 		user_active = $4,
 		updated_at = $5
-		where id = $6
+		where id = $6 and deleted_at is null
 	`
 
 	_, err := db.ExecContext(ctx, stmt,
@@ -280,6 +306,57 @@ func (u *User) DeleteByID(id int) error {
 	return nil
 }
 
+// Deactivate stops the user with the given id from signing in, until Reactivate.
+// It returns false when the user doesn't exist or is already deactivated.
+func (u *User) Deactivate(id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update users set user_active = 0, deactivated_at = $1, updated_at = $1
+	where id = $2 and deactivated_at is null and deleted_at is null`
+
+	result, err := db.ExecContext(ctx, stmt, now, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// Reactivate lets a deactivated user sign in again.
+// It returns false when the user doesn't exist or isn't deactivated.
+func (u *User) Reactivate(id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set user_active = 1, deactivated_at = null, updated_at = $1
+	where id = $2 and deactivated_at is not null and deleted_at is null`
+
+	result, err := db.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// SoftDelete deactivates the user with the given id and hides it from every lookup,
+// the row is kept for the records that refer to it
+func (u *User) SoftDelete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update users set user_active = 0, deactivated_at = coalesce(deactivated_at, $1), deleted_at = $1, updated_at = $1
+	where id = $2 and deleted_at is null`
+
+	_, err := db.ExecContext(ctx, stmt, now, id)
+	return err
+}
+
 func (u *User) GenerateCircleAvatar(initial string) ([]byte, error) {
 	size := 200
 	newAvatar, err := avatar.NewAvatarFromInitials([]byte(initial), &avatar.InitialsOptions{
@@ -307,11 +384,16 @@ func (u *User) GenerateCircleAvatar(initial string) ([]byte, error) {
 	return round, err
 }
 
-// Insert inserts a new user into the database, and returns the ID of the newly inserted row
-func (u *User) Insert(user User) (int, error) {
+// Insert inserts a new user into the database, and returns the ID of the newly inserted row.
+// The user.created event and events are added to the outbox with it.
+func (u *User) Insert(user User, events ...OutboxEvent) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
+	if user.Password == "" {
+		return 0, ErrPasswordRequired
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
 	if err != nil {
 		return 0, err
@@ -324,20 +406,32 @@ func (u *User) Insert(user User) (int, error) {
 		return 0, err
 	}
 
-	stmt := `insert into users (email, first_name, last_name, password, avatar, user_active, last_login, password_changed_at, created_at, updated_at)
-	values ($1, $2, $3, $4, $5::bytea, $6, $7, $8, $9, $10) returning id`
+	if user.Role == "" {
+		user.Role = RoleReadOnly
+	}
 
-	row := db.QueryRowContext(ctx, stmt,
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	stmt := `insert into users (email, first_name, last_name, password, avatar, user_active, role, last_login, password_changed_at, created_at, updated_at)
+	values ($1, $2, $3, $4, $5::bytea, $6, $7, $8, $9, $10, $11) returning id`
+
+	row := tx.QueryRowContext(ctx, stmt,
 		user.Email,
 		user.FirstName,
 		user.LastName,
 		hashedPassword,
 		avatar,
 		user.Active,
+		user.Role,
 		user.LastLogin,
 		user.PasswordChangeAt,
-		time.Now(),
-		time.Now(),
+		now,
+		now,
 	)
 	var newID int
 	err = row.Scan(&newID)
@@ -349,23 +443,56 @@ func (u *User) Insert(user User) (int, error) {
 	}
 	log.Printf("return id: %d", newID)
 
-	return newID, nil
+	created := OutboxEvent{Topic: TopicUserCreated, Payload: UserCreated{
+		ID:        newID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.Role,
+	}}
+	if err := addToOutbox(ctx, tx, now, append([]OutboxEvent{created}, events...)...); err != nil {
+		return 0, err
+	}
+
+	return newID, tx.Commit()
 }
 
 // ResetPassword is the method we will use to change a user's password.
-func (u *User) ResetPassword(password string) error {
+// The current password is kept in the password history, events are added to the outbox with the change.
+func (u *User) ResetPassword(password string, events ...OutboxEvent) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := setPassword(ctx, tx, u.ID, hashedPassword, now); err != nil {
+		return err
+	}
+
+	if err := addToOutbox(ctx, tx, now, events...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
 
-	var password_changed_at = time.Now()
+// SetRole changes the role of the user with the given id
+func (u *User) SetRole(id int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
 
-	stmt := `update users set password = $1, password_changed_at = $2 where id = $3`
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, password_changed_at, u.ID)
+	stmt := `update users set role = $1, updated_at = $2 where id = $3`
+	_, err := db.ExecContext(ctx, stmt, role, time.Now(), id)
 	if err != nil {
 		return err
 	}
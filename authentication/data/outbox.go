@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// the topics of the messages the authentication service sends to the rest of the stack
+const (
+	TopicMailRequested  = "mail.requested"
+	TopicUserCreated    = "user.created"
+	TopicPasswordChange = "password.changed"
+	TopicAuditRecorded  = "audit.recorded"
+)
+
+// OutboxEvent is a message for another service. It is written to the outbox in the transaction
+// of the change it is about, so it is sent if and only if the change is committed.
+type OutboxEvent struct {
+	Topic   string
+	Payload interface{}
+}
+
+// OutboxMessage is an event waiting in the outbox. NextAttemptAt is when it is tried again,
+// and while a relay is delivering it when the relay's claim on it runs out. A message that
+// failed too often is dead, it stays in the outbox for an administrator to look at.
+type OutboxMessage struct {
+	ID            int64           `json:"id"`
+	Topic         string          `json:"topic"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	DeadAt        *time.Time      `json:"dead_at,omitempty"`
+}
+
+// ErrOutboxLeaseLost is returned when the attempt being recorded is no longer the current one,
+// the lease ran out and another relay claimed the message
+var ErrOutboxLeaseLost = errors.New("outbox message claimed by another relay")
+
+// Outbox is the table of the messages the relay delivers
+type Outbox struct{}
+
+// UserCreated is the payload of TopicUserCreated
+type UserCreated struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+}
+
+// PasswordChanged is the payload of TopicPasswordChange
+type PasswordChanged struct {
+	UserID    int       `json:"user_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// addToOutbox writes events to the outbox as part of tx
+func addToOutbox(ctx context.Context, tx *sql.Tx, now time.Time, events ...OutboxEvent) error {
+	stmt := `insert into outbox (topic, payload, attempts, next_attempt_at, last_error, created_at)
+	values ($1, $2, 0, $3, '', $3)`
+
+	for _, event := range events {
+		payload, err := json.Marshal(event.Payload)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, stmt, event.Topic, string(payload), now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Claim hands the oldest message that is due to a relay, for lease, and counts the attempt.
+// A message whose relay died is due again once its lease runs out. It returns nil when no
+// message is due.
+func (o *Outbox) Claim(lease time.Duration) (*OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update outbox set attempts = attempts + 1, next_attempt_at = $1
+	where id = (
+		select id from outbox
+		where delivered_at is null and dead_at is null and next_attempt_at <= $2
+		order by id
+		limit 1
+		for update skip locked
+	)
+	returning id, topic, payload, attempts, next_attempt_at, last_error, created_at`
+
+	var message OutboxMessage
+	var payload []byte
+	err := db.QueryRowContext(ctx, stmt, now.Add(lease), now).Scan(&message.ID, &message.Topic, &payload,
+		&message.Attempts, &message.NextAttemptAt, &message.LastError, &message.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	message.Payload = payload
+
+	return &message, nil
+}
+
+// MarkDelivered records that the attempt of message was delivered and drops its payload,
+// mail can hold links with live tokens that are only stored hashed everywhere else
+func (o *Outbox) MarkDelivered(message *OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update outbox set delivered_at = $1, last_error = '', payload = null
+	where id = $2 and attempts = $3 and delivered_at is null and dead_at is null`
+	result, err := db.ExecContext(ctx, stmt, time.Now(), message.ID, message.Attempts)
+
+	return checkOutboxAttempt(result, err)
+}
+
+// MarkFailed records why the attempt of message failed. It is tried again at retryAt, or
+// is dead when it has been tried maxAttempts times.
+func (o *Outbox) MarkFailed(message *OutboxMessage, maxAttempts int, reason string, retryAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var deadAt *time.Time
+	if message.Attempts >= maxAttempts {
+		now := time.Now()
+		deadAt = &now
+	}
+
+	stmt := `update outbox set last_error = $1, next_attempt_at = $2, dead_at = $3
+	where id = $4 and attempts = $5 and delivered_at is null and dead_at is null`
+	result, err := db.ExecContext(ctx, stmt, reason, retryAt, deadAt, message.ID, message.Attempts)
+
+	return checkOutboxAttempt(result, err)
+}
+
+// checkOutboxAttempt turns the update of an attempt that matched no message into ErrOutboxLeaseLost
+func checkOutboxAttempt(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrOutboxLeaseLost
+	}
+
+	return nil
+}
+
+// DeleteDeliveredBefore removes the messages delivered, or dead, before t and returns how many
+func (o *Outbox) DeleteDeliveredBefore(t time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `delete from outbox where delivered_at < $1 or dead_at < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how many previous passwords are kept per user, PasswordPolicy.History can't look further back
+const passwordHistoryLimit = 24
+
+var ErrPasswordRequired = errors.New("password is required")
+
+//go:embed common-passwords.txt
+var commonPasswordList string
+
+// commonPasswords holds the lowercased entries of common-passwords.txt
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+func parseCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+
+	return passwords
+}
+
+// PasswordPolicy is what a new password must satisfy
+type PasswordPolicy struct {
+	MinLength  int           // characters, not bytes
+	MinClasses int           // of lower case, upper case, digits and symbols
+	History    int           // the number of previous passwords that can't be used again, the current one included
+	MaxAge     time.Duration // after which the password must be changed, 0 never expires
+}
+
+// Validate returns why password can't be used by the user with email, or nil.
+// The errors are meant to be shown to the user.
+func (p PasswordPolicy) Validate(password, email string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	if n := len([]rune(password)); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if lower+upper+digit+symbol < p.MinClasses {
+		return fmt.Errorf("password must use at least %d of lower case letters, upper case letters, digits and symbols", p.MinClasses)
+	}
+
+	if commonPasswords[strings.ToLower(password)] {
+		return errors.New("password is too common, choose another one")
+	}
+
+	if name, _, found := strings.Cut(strings.ToLower(email), "@"); found && len(name) >= 3 &&
+		strings.Contains(strings.ToLower(password), name) {
+		return errors.New("password must not contain your email address")
+	}
+
+	return nil
+}
+
+// Expired reports whether a password changed at changedAt must be changed at now
+func (p PasswordPolicy) Expired(changedAt, now time.Time) bool {
+	return p.MaxAge > 0 && now.Sub(changedAt) > p.MaxAge
+}
+
+// PasswordReused reports whether password is the current one of the user or one of
+// the n-1 before it
+func (u *User) PasswordReused(userID int, password string, n int) (bool, error) {
+	if n <= 0 {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select password from users where id = $1
+	union all
+	(select password_hash from password_history where user_id = $1 order by created_at desc limit $2)`
+
+	rows, err := db.QueryContext(ctx, query, userID, n-1)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// hashPassword returns how password is stored. It's slow on purpose, so it's done before
+// the transaction that stores it is opened.
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), 12)
+}
+
+// setPassword moves the current password of the user into its history and replaces it with
+// hashedPassword, as part of tx. The password.changed event goes to the outbox with it.
+func setPassword(ctx context.Context, tx *sql.Tx, userID int, hashedPassword []byte, now time.Time) error {
+	stmt := `insert into password_history (user_id, password_hash, created_at)
+	select id, password, $2 from users where id = $1`
+	if _, err := tx.ExecContext(ctx, stmt, userID, now); err != nil {
+		return err
+	}
+
+	stmt = `delete from password_history where user_id = $1 and id not in
+	(select id from password_history where user_id = $1 order by created_at desc, id desc limit $2)`
+	if _, err := tx.ExecContext(ctx, stmt, userID, passwordHistoryLimit); err != nil {
+		return err
+	}
+
+	stmt = `update users set password = $1, password_changed_at = $2, updated_at = $2 where id = $3`
+	if _, err := tx.ExecContext(ctx, stmt, hashedPassword, now, userID); err != nil {
+		return err
+	}
+
+	return addToOutbox(ctx, tx, now, OutboxEvent{
+		Topic:   TopicPasswordChange,
+		Payload: PasswordChanged{UserID: userID, ChangedAt: now},
+	})
+}
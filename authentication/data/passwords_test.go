@@ -0,0 +1,62 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MinClasses: 3}
+
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"empty", "", false},
+		{"too short", "Ab1!", false},
+		{"two classes", "abcdefgh1234", false},
+		{"common", "Password123", false},
+		{"common in other case", "PASSWORD1234", false},
+		{"contains email", "Xjohn.doe42", false},
+		{"good", "Tr0ub4dor&3x", true},
+		{"multibyte letters count once", "Mật khẩu mới 9", true},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate(tt.password, "john.doe@example.com")
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestPasswordPolicy_Expired(t *testing.T) {
+	now := time.Now()
+
+	if (PasswordPolicy{}).Expired(time.Time{}, now) {
+		t.Error("passwords must not expire without a maximum age")
+	}
+
+	policy := PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	if policy.Expired(now.Add(-24*time.Hour), now) {
+		t.Error("a password changed yesterday must not be expired")
+	}
+	if !policy.Expired(now.Add(-91*24*time.Hour), now) {
+		t.Error("a password older than the maximum age must be expired")
+	}
+	if !policy.Expired(time.Time{}, now) {
+		t.Error("a password that was never changed must be expired")
+	}
+}
+
+func TestCommonPasswords_Loaded(t *testing.T) {
+	if len(commonPasswords) < 100 {
+		t.Fatalf("expected the embedded list to be loaded, got %d entries", len(commonPasswords))
+	}
+	for password := range commonPasswords {
+		if password[0] == '#' {
+			t.Errorf("comment %q must be skipped", password)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+var ErrResetTokenInvalid = errors.New("reset token is invalid, used or expired")
+
+// PasswordReset is a single-use token letting a user choose a new password.
+// Like API keys only the SHA-256 of the token is stored.
+type PasswordReset struct{}
+
+// NewResetToken returns a random reset token, in clear
+func NewResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Insert stores token as the reset token of the user valid for ttl, replacing the unused ones
+// the user asked for before. events, like the mail carrying the token, go to the outbox with it.
+func (p *PasswordReset) Insert(userID int, token string, ttl time.Duration, events ...OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from password_resets where user_id = $1 and used_at is null`, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	stmt := `insert into password_resets (token_hash, user_id, expires_at, created_at) values ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, stmt, HashToken(token), userID, now.Add(ttl), now)
+	if err != nil {
+		return err
+	}
+
+	if err := addToOutbox(ctx, tx, now, events...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Consume uses up the token and sets the new password of its user in one transaction,
+// so a token can't be used twice, events go to the outbox with it. It returns the id of the user.
+func (p *PasswordReset) Consume(token, password string, events ...OutboxEvent) (int, error) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var userID int
+	stmt := `update password_resets set used_at = $1
+	where token_hash = $2 and used_at is null and expires_at > $1 returning user_id`
+	err = tx.QueryRowContext(ctx, stmt, now, HashToken(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := setPassword(ctx, tx, userID, hashedPassword, now); err != nil {
+		return 0, err
+	}
+
+	if err := addToOutbox(ctx, tx, now, events...); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// UserID returns the id of the user a usable token belongs to, without using it up
+func (p *PasswordReset) UserID(token string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var userID int
+	query := `select user_id from password_resets where token_hash = $1 and used_at is null and expires_at > $2`
+	err := db.QueryRowContext(ctx, query, HashToken(token), time.Now()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+
+	return userID, err
+}
+
+// DeleteExpired removes the tokens that can't be used anymore
+func (p *PasswordReset) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `delete from password_resets where expires_at < $1 or used_at is not null`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
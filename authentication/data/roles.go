@@ -0,0 +1,54 @@
+package data
+
+// the roles a user can have, stored in users.role
+const (
+	RoleAdmin      = "admin"
+	RoleStaff      = "staff"
+	RoleTeacher    = "teacher"
+	RoleAccountant = "accountant"
+	RoleReadOnly   = "read-only"
+)
+
+// the permissions checked by the routes of the authentication service
+const (
+	PermUsersRead  = "users:read"
+	PermUsersWrite = "users:write"
+	PermRolesWrite = "roles:write"
+	PermAPIKeys    = "apikeys:write"
+	PermAuditRead  = "audit:read"
+)
+
+// rolePermissions lists what every role may do in the authentication service.
+// Every signed-in user may always manage their own account.
+var rolePermissions = map[string][]string{
+	RoleAdmin:      {PermUsersRead, PermUsersWrite, PermRolesWrite, PermAPIKeys, PermAuditRead},
+	RoleStaff:      {PermUsersRead},
+	RoleTeacher:    {},
+	RoleAccountant: {},
+	RoleReadOnly:   {},
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles returns every role with its permissions
+func Roles() map[string][]string {
+	roles := map[string][]string{}
+	for role, perms := range rolePermissions {
+		roles[role] = append([]string{}, perms...)
+	}
+	return roles
+}
+
+// HasPermission reports whether the user's role grants perm
+func (u *User) HasPermission(perm string) bool {
+	for _, p := range rolePermissions[u.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,394 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound is returned by a SessionStore when the token is unknown
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session holds the username of a signed-in user and the time at which the session expires.
+// It is keyed by the token we hand out in the session cookie. The ID stays the same when the
+// token is rotated, so users can tell their sessions apart and revoke them without the token.
+type Session struct {
+	ID         string    `json:"id"`
+	Token      string    `json:"-"`
+	Username   string    `json:"username"`
+	Expiry     time.Time `json:"expiry"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+// IsExpired reports whether the session can no longer be used
+func (s *Session) IsExpired() bool {
+	return s.Expiry.Before(time.Now())
+}
+
+// SessionStore is the interface every session backend implements. Sessions live outside
+// the process so that a restart doesn't log everyone out and several replicas can share them.
+type SessionStore interface {
+	// Get returns the session for token, or ErrSessionNotFound
+	Get(token string) (*Session, error)
+	// Save creates or replaces the session keyed by s.Token
+	Save(s Session) error
+	// Rotate atomically replaces the session for oldToken with next. It returns
+	// ErrSessionNotFound when oldToken was already rotated or deleted, so two
+	// concurrent refreshes of the same session can't both succeed.
+	Rotate(oldToken string, next Session) error
+	// Delete removes the session for token; deleting an unknown token is not an error
+	Delete(token string) error
+	// DeleteByUser removes every session of username, signing the user out everywhere
+	DeleteByUser(username string) error
+	// DeleteByID removes the session of username with the given id, or returns ErrSessionNotFound
+	DeleteByID(username, id string) error
+	// DeleteOthers removes every session of username but the one for token
+	DeleteOthers(username, token string) error
+	// List returns the sessions of username that haven't expired, the latest used first
+	List(username string) ([]Session, error)
+	// Touch records that the session for token was used at from ip
+	Touch(token string, at time.Time, ip string) error
+	// DeleteExpired removes every expired session and returns how many were removed
+	DeleteExpired() (int64, error)
+}
+
+// PostgresSessionStore keeps sessions in the sessions table
+type PostgresSessionStore struct{}
+
+// NewPostgresSessionStore returns a session store backed by the database passed to New
+func NewPostgresSessionStore() *PostgresSessionStore {
+	return &PostgresSessionStore{}
+}
+
+func (s *PostgresSessionStore) Get(token string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + sessionColumns + ` from sessions where token = $1`
+
+	session, err := scanSession(db.QueryRowContext(ctx, query, token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+const sessionColumns = `id, token, username, expiry, created_at, last_seen_at, ip, user_agent`
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.Token,
+		&session.Username,
+		&session.Expiry,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.IP,
+		&session.UserAgent,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *PostgresSessionStore) Save(session Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into sessions (` + sessionColumns + `) values ($1, $2, $3, $4, $5, $6, $7, $8)
+	on conflict (token) do update set username = excluded.username, expiry = excluded.expiry,
+	last_seen_at = excluded.last_seen_at, ip = excluded.ip, user_agent = excluded.user_agent`
+
+	_, err := db.ExecContext(ctx, stmt, session.ID, session.Token, session.Username, session.Expiry,
+		session.CreatedAt, session.LastSeenAt, session.IP, session.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresSessionStore) Rotate(oldToken string, next Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `delete from sessions where token = $1`, oldToken)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+
+	stmt := `insert into sessions (` + sessionColumns + `) values ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.ExecContext(ctx, stmt, next.ID, next.Token, next.Username, next.Expiry,
+		next.CreatedAt, next.LastSeenAt, next.IP, next.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresSessionStore) Delete(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from sessions where token = $1`
+
+	_, err := db.ExecContext(ctx, stmt, token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresSessionStore) DeleteByUser(username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `delete from sessions where username = $1`, username)
+
+	return err
+}
+
+func (s *PostgresSessionStore) DeleteByID(username, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `delete from sessions where username = $1 and id = $2`, username, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresSessionStore) DeleteOthers(username, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `delete from sessions where username = $1 and token <> $2`, username, token)
+
+	return err
+}
+
+func (s *PostgresSessionStore) List(username string) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + sessionColumns + ` from sessions where username = $1 and expiry > $2 order by last_seen_at desc`
+
+	rows, err := db.QueryContext(ctx, query, username, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *PostgresSessionStore) Touch(token string, at time.Time, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `update sessions set last_seen_at = $1, ip = $2 where token = $3`, at, ip, token)
+
+	return err
+}
+
+func (s *PostgresSessionStore) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from sessions where expiry < $1`
+
+	result, err := db.ExecContext(ctx, stmt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// MemorySessionStore keeps sessions in process memory. It is meant for tests and
+// single-instance development setups; everything is lost on restart.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore returns an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: map[string]Session{},
+	}
+}
+
+func (s *MemorySessionStore) Get(token string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[token]
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+func (s *MemorySessionStore) Save(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.Token] = session
+
+	return nil
+}
+
+func (s *MemorySessionStore) Rotate(oldToken string, next Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[oldToken]; !exists {
+		return ErrSessionNotFound
+	}
+
+	delete(s.sessions, oldToken)
+	s.sessions[next.Token] = next
+
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, token)
+
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteByUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, session := range s.sessions {
+		if session.Username == username {
+			delete(s.sessions, token)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteByID(username, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, session := range s.sessions {
+		if session.Username == username && session.ID == id {
+			delete(s.sessions, token)
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (s *MemorySessionStore) DeleteOthers(username, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for other, session := range s.sessions {
+		if session.Username == username && other != token {
+			delete(s.sessions, other)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) List(username string) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []Session{}
+	for _, session := range s.sessions {
+		if session.Username == username && !session.IsExpired() {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Touch(token string, at time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[token]; exists {
+		session.LastSeenAt = at
+		session.IP = ip
+		s.sessions[token] = session
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteExpired() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for token, session := range s.sessions {
+		if session.IsExpired() {
+			delete(s.sessions, token)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
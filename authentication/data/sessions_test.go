@@ -0,0 +1,173 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStore_ConcurrentAccess(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	const workers = 50
+	const rounds = 100
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				token := fmt.Sprintf("token-%d-%d", w, r)
+				err := store.Save(Session{Token: token, Username: "user@example.com", Expiry: time.Now().Add(time.Hour)})
+				if err != nil {
+					t.Errorf("Save: %s", err)
+					return
+				}
+
+				if _, err := store.Get(token); err != nil {
+					t.Errorf("Get: %s", err)
+					return
+				}
+
+				next := Session{Token: token + "-next", Username: "user@example.com", Expiry: time.Now().Add(time.Hour)}
+				if err := store.Rotate(token, next); err != nil {
+					t.Errorf("Rotate: %s", err)
+					return
+				}
+
+				if err := store.Delete(next.Token); err != nil {
+					t.Errorf("Delete: %s", err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	// the garbage collector runs while handlers use the store
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if _, err := store.DeleteExpired(); err != nil {
+				t.Errorf("DeleteExpired: %s", err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	if len(store.sessions) != 0 {
+		t.Errorf("expected an empty store, got %d sessions", len(store.sessions))
+	}
+}
+
+func TestMemorySessionStore_RotateOnlyOnce(t *testing.T) {
+	store := NewMemorySessionStore()
+	store.Save(Session{Token: "old", Username: "user@example.com", Expiry: time.Now().Add(time.Hour)})
+
+	const workers = 20
+
+	var wins int32
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			next := Session{Token: fmt.Sprintf("new-%d", w), Username: "user@example.com", Expiry: time.Now().Add(time.Hour)}
+			err := store.Rotate("old", next)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&wins, 1)
+			case !errors.Is(err, ErrSessionNotFound):
+				t.Errorf("Rotate: unexpected error %s", err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if wins != 1 {
+		t.Errorf("expected exactly one successful rotation, got %d", wins)
+	}
+
+	if _, err := store.Get("old"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("old session should be gone, got %v", err)
+	}
+}
+
+func TestMemorySessionStore_DeleteExpired(t *testing.T) {
+	store := NewMemorySessionStore()
+	store.Save(Session{Token: "expired", Username: "a@example.com", Expiry: time.Now().Add(-time.Minute)})
+	store.Save(Session{Token: "valid", Username: "b@example.com", Expiry: time.Now().Add(time.Hour)})
+
+	removed, err := store.DeleteExpired()
+	if err != nil {
+		t.Fatalf("DeleteExpired: %s", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed session, got %d", removed)
+	}
+
+	if _, err := store.Get("valid"); err != nil {
+		t.Errorf("valid session was removed: %s", err)
+	}
+}
+
+func TestMemorySessionStore_DeleteByUser(t *testing.T) {
+	store := NewMemorySessionStore()
+	store.Save(Session{Token: "laptop", Username: "a@example.com", Expiry: time.Now().Add(time.Hour)})
+	store.Save(Session{Token: "phone", Username: "a@example.com", Expiry: time.Now().Add(time.Hour)})
+	store.Save(Session{Token: "other", Username: "b@example.com", Expiry: time.Now().Add(time.Hour)})
+
+	if err := store.DeleteByUser("a@example.com"); err != nil {
+		t.Fatalf("DeleteByUser: %s", err)
+	}
+
+	for _, token := range []string{"laptop", "phone"} {
+		if _, err := store.Get(token); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("session %s should be gone, got %v", token, err)
+		}
+	}
+	if _, err := store.Get("other"); err != nil {
+		t.Errorf("session of another user was removed: %s", err)
+	}
+}
+
+func TestMemorySessionStore_ListAndRevoke(t *testing.T) {
+	store := NewMemorySessionStore()
+	now := time.Now()
+	store.Save(Session{ID: "1", Token: "laptop", Username: "a@example.com", Expiry: now.Add(time.Hour), LastSeenAt: now.Add(-time.Hour)})
+	store.Save(Session{ID: "2", Token: "phone", Username: "a@example.com", Expiry: now.Add(time.Hour), LastSeenAt: now})
+	store.Save(Session{ID: "3", Token: "tablet", Username: "a@example.com", Expiry: now.Add(time.Hour), LastSeenAt: now})
+	store.Save(Session{ID: "4", Token: "old", Username: "a@example.com", Expiry: now.Add(-time.Minute)})
+	store.Save(Session{ID: "5", Token: "other", Username: "b@example.com", Expiry: now.Add(time.Hour)})
+
+	sessions, err := store.List("a@example.com")
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(sessions) != 3 || sessions[2].ID != "1" {
+		t.Fatalf("expected the 3 valid sessions, the least recently used last, got %+v", sessions)
+	}
+
+	if err := store.DeleteByID("b@example.com", "2"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("a session of another user must not be revoked, got %v", err)
+	}
+	if err := store.DeleteByID("a@example.com", "2"); err != nil {
+		t.Errorf("DeleteByID: %s", err)
+	}
+
+	if err := store.DeleteOthers("a@example.com", "laptop"); err != nil {
+		t.Fatalf("DeleteOthers: %s", err)
+	}
+	if sessions, _ := store.List("a@example.com"); len(sessions) != 1 || sessions[0].Token != "laptop" {
+		t.Errorf("expected only the kept session, got %+v", sessions)
+	}
+	if _, err := store.Get("other"); err != nil {
+		t.Errorf("session of another user was removed: %s", err)
+	}
+}
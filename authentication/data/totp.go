@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTOTPNotFound      = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyActive = errors.New("two-factor authentication is already enabled")
+	ErrTOTPCodeReused    = errors.New("code was already used")
+)
+
+// TOTP is the second factor of a user. It only counts once the user confirmed it with a code.
+type TOTP struct {
+	UserID      int        `json:"user_id"`
+	Secret      string     `json:"-"`
+	LastStep    int64      `json:"-"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Enabled reports whether the user confirmed the second factor
+func (t *TOTP) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+// Get returns the second factor of the user
+func (t *TOTP) Get(userID int) (*TOTP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	totp := TOTP{UserID: userID}
+	var confirmedAt sql.NullTime
+
+	query := `select secret, last_step, confirmed_at, created_at from user_totp where user_id = $1`
+	err := db.QueryRowContext(ctx, query, userID).Scan(&totp.Secret, &totp.LastStep, &confirmedAt, &totp.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		totp.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return &totp, nil
+}
+
+// Begin stores a new unconfirmed secret for the user, replacing an unconfirmed one
+func (t *TOTP) Begin(userID int, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into user_totp (user_id, secret, last_step, created_at) values ($1, $2, 0, $3)
+	on conflict (user_id) do update set secret = $2, last_step = 0, created_at = $3
+	where user_totp.confirmed_at is null`
+
+	result, err := db.ExecContext(ctx, stmt, userID, secret, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTOTPAlreadyActive
+	}
+
+	return nil
+}
+
+// UseStep records that the code of time step was accepted, so it can't be replayed
+func (t *TOTP) UseStep(userID int, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `update user_totp set last_step = $1 where user_id = $2 and last_step < $1`, step, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+// Confirm enables the second factor and replaces the recovery codes of the user
+func (t *TOTP) Confirm(userID int, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `update user_totp set confirmed_at = $1 where user_id = $2 and confirmed_at is null`, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTOTPNotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable removes the second factor and the recovery codes of the user
+func (t *TOTP) Disable(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `delete from user_totp where user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NormalizeRecoveryCode makes codes typed with dashes, spaces or in lower case match
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codes []string) error {
+	if _, err := tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		stmt := `insert into recovery_codes (user_id, code_hash) values ($1, $2)`
+		if _, err := tx.ExecContext(ctx, stmt, userID, HashToken(NormalizeRecoveryCode(code))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps the recovery codes of the user for new ones
+func (t *TOTP) ReplaceRecoveryCodes(userID int, codes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode uses up one of the recovery codes of the user, it returns false
+// when the code is unknown or was used before
+func (t *TOTP) UseRecoveryCode(userID int, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update recovery_codes set used_at = $1 where user_id = $2 and code_hash = $3 and used_at is null`
+	result, err := db.ExecContext(ctx, stmt, time.Now(), userID, HashToken(NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// RequiredRoles returns the roles whose users must use a second factor
+func (t *TOTP) RequiredRoles() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `select role from totp_required_roles order by role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// Required reports whether users with role must use a second factor
+func (t *TOTP) Required(role string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var required bool
+	err := db.QueryRowContext(ctx, `select exists(select 1 from totp_required_roles where role = $1)`, role).Scan(&required)
+
+	return required, err
+}
+
+// SetRequired makes a second factor mandatory or optional for the users of role
+func (t *TOTP) SetRequired(role string, required bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var err error
+	if required {
+		_, err = db.ExecContext(ctx, `insert into totp_required_roles (role) values ($1) on conflict do nothing`, role)
+	} else {
+		_, err = db.ExecContext(ctx, `delete from totp_required_roles where role = $1`, role)
+	}
+
+	return err
+}
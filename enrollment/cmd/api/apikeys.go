@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// the scope API keys need to call this service
+const apiKeyScope = "enrollment"
+
+// accepted keys are checked again with the authentication service after this,
+// so a revoked key stops working within this time
+const apiKeyCacheTTL = time.Minute
+
+var (
+	errAPIKeyMissing  = errors.New("api key is required")
+	errAPIKeyRejected = errors.New("api key rejected")
+)
+
+// APIKeys checks the API keys of the clients with the authentication service,
+// which issues them, and remembers the accepted ones for a while
+type APIKeys struct {
+	url      string
+	client   *http.Client
+	mu       sync.Mutex
+	accepted map[[sha256.Size]byte]time.Time
+}
+
+func NewAPIKeys(url string) *APIKeys {
+	return &APIKeys{
+		url:      url,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		accepted: make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+// Verify returns nil when key may be used against this service
+func (k *APIKeys) Verify(key string) error {
+	// keys are only kept hashed, like in the authentication service
+	sum := sha256.Sum256([]byte(key))
+	now := time.Now()
+
+	k.mu.Lock()
+	until, ok := k.accepted[sum]
+	k.mu.Unlock()
+	if ok && now.Before(until) {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{"key": key, "scope": apiKeyScope})
+	if err != nil {
+		return err
+	}
+
+	response, err := k.client.Post(k.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		k.mu.Lock()
+		delete(k.accepted, sum)
+		k.mu.Unlock()
+		return errAPIKeyRejected
+	default:
+		return fmt.Errorf("verifying api key: status %d", response.StatusCode)
+	}
+
+	k.mu.Lock()
+	for cached, until := range k.accepted {
+		if now.After(until) {
+			delete(k.accepted, cached)
+		}
+	}
+	k.accepted[sum] = now.Add(apiKeyCacheTTL)
+	k.mu.Unlock()
+
+	return nil
+}
+
+// the number of leading characters of a key the authentication service lists it under
+const apiKeyPrefixLength = 8
+
+// apiKeyActor names the client calling with key, in the history of the enrollments and the
+// audit trail, by the prefix the authentication service lists the key under
+func apiKeyActor(key string) string {
+	if len(key) > apiKeyPrefixLength {
+		key = key[:apiKeyPrefixLength]
+	}
+
+	return "apikey:" + key
+}
+
+// authenticateKey checks the API key of a net/rpc or gRPC call and returns the actor of the call
+func (app *Config) authenticateKey(key string) (string, error) {
+	if key == "" {
+		return "", errAPIKeyMissing
+	}
+
+	if err := app.APIKeys.Verify(key); err != nil {
+		if !errors.Is(err, errAPIKeyRejected) {
+			log.Printf("authenticateKey: %s", err)
+		}
+		return "", err
+	}
+
+	return apiKeyActor(key), nil
+}
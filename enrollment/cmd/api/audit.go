@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the actions recorded in the audit trail
+const (
+	auditEnrollmentCreated = "enrollment.created"
+	auditEnrollmentUpdated = "enrollment.updated"
+	auditEnrollmentDeleted = "enrollment.deleted"
+	auditEnrollmentStatus  = "enrollment.status_changed"
+	auditPaymentRecorded   = "payment.recorded"
+	auditRefundRecorded    = "refund.recorded"
+	auditCommentAdded      = "comment.added"
+	auditCommentEdited     = "comment.edited"
+	auditCommentDeleted    = "comment.deleted"
+	auditClassCreated      = "class.created"
+	auditClassUpdated      = "class.updated"
+	auditClassDeleted      = "class.deleted"
+	auditStudentCreated    = "student.created"
+	auditStudentUpdated    = "student.updated"
+	auditGuardianCreated   = "guardian.created"
+	auditGuardianUpdated   = "guardian.updated"
+	auditGuardianLinked    = "guardian.linked"
+	auditGuardianUnlinked  = "guardian.unlinked"
+)
+
+// auditEntry is an entry of the audit trail the logger keeps for the whole stack
+type auditEntry struct {
+	Service string      `json:"service"`
+	Action  string      `json:"action"`
+	Actor   string      `json:"actor"`
+	Target  string      `json:"target"`
+	IP      string      `json:"ip"`
+	Before  interface{} `json:"before,omitempty"`
+	After   interface{} `json:"after,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// audit records a change made by the signed-in user in the audit trail. before and after are
+// what was changed, nil when it was created or removed, the logger keeps the fields that differ.
+// Failing to record doesn't fail the request, the change is done already.
+func (app *Config) audit(ctx *gin.Context, action, target string, before, after interface{}) {
+	var actor string
+	if identity := currentUser(ctx); identity != nil {
+		actor = identity.Email
+	}
+
+	app.recordAudit(actor, ctx.ClientIP(), action, target, before, after)
+}
+
+// recordAudit records a change made by actor from ip, for the callers that have no gin context
+func (app *Config) recordAudit(actor, ip, action, target string, before, after interface{}) {
+	entry := auditEntry{
+		Service: "enrollment",
+		Action:  action,
+		Actor:   actor,
+		Target:  target,
+		IP:      ip,
+		Before:  before,
+		After:   after,
+		Time:    time.Now(),
+	}
+
+	if err := sendAudit(entry); err != nil {
+		log.Printf("Can't record %s %s in the audit trail: %s", action, target, err)
+	}
+}
+
+// sendAudit posts entry to the audit trail of the logger
+func sendAudit(entry auditEntry) error {
+	jsonData, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", auditServiceURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("logger service responded with %d", response.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+var errUnknownClass = errors.New("class does not exist")
+
+// validateClass checks the fields a client must send when creating or updating a class
+func validateClass(class *data.Class) error {
+	if class.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if class.Capacity <= 0 {
+		return errors.New("capacity must be greater than 0")
+	}
+
+	return nil
+}
+
+// checkClasses checks that every class id exists, for the students who don't take a seat
+func (app *Config) checkClasses(classIDs []string) error {
+	for _, id := range classIDs {
+		if _, err := app.Models.Class.GetOne(id); err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				return fmt.Errorf("%w: %s", errUnknownClass, id)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seatClasses takes a seat in every class that still has a free one and returns them,
+// with the full ones, where the student goes on the waitlist. When a class doesn't exist
+// the seats already taken are given back. The caller gives back the seats it took when
+// it fails to store them. Both lists are empty rather than nil, they are stored as arrays
+// that Promote adds to.
+func (app *Config) seatClasses(classIDs []string) (seated, waiting []string, err error) {
+	seated, waiting = []string{}, []string{}
+	for _, id := range classIDs {
+		err := app.Models.Class.TakeSeat(id)
+		switch {
+		case err == nil:
+			seated = append(seated, id)
+		case errors.Is(err, data.ErrClassFull):
+			waiting = append(waiting, id)
+		default:
+			app.releaseClassSeats(seated)
+			if errors.Is(err, data.ErrNotFound) {
+				return nil, nil, fmt.Errorf("%w: %s", errUnknownClass, id)
+			}
+			return nil, nil, err
+		}
+	}
+
+	return seated, waiting, nil
+}
+
+// releaseClassSeats gives back one seat in every class
+func (app *Config) releaseClassSeats(classIDs []string) {
+	for _, id := range classIDs {
+		if err := app.Models.Class.ReleaseSeat(id); err != nil {
+			log.Printf("Can't release a seat of class %s: %s", id, err)
+		}
+	}
+}
+
+// classErrorJSON writes the response for an error returned by checkClasses or seatClasses
+func classErrorJSON(ctx *gin.Context, err error) {
+	if errors.Is(err, errUnknownClass) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+}
+
+// uniqueIDs returns ids without the repeated ones, in the order they first appear
+func uniqueIDs(ids []string) []string {
+	if ids == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// addedIDs returns the ids in next that are not in prev
+func addedIDs(prev, next []string) []string {
+	known := map[string]bool{}
+	for _, id := range prev {
+		known[id] = true
+	}
+
+	var added []string
+	for _, id := range next {
+		if !known[id] {
+			added = append(added, id)
+		}
+	}
+
+	return added
+}
+
+// keptIDs returns the ids in prev that are still in next, an empty list when none is
+func keptIDs(prev, next []string) []string {
+	wanted := map[string]bool{}
+	for _, id := range next {
+		wanted[id] = true
+	}
+
+	kept := []string{}
+	for _, id := range prev {
+		if wanted[id] {
+			kept = append(kept, id)
+		}
+	}
+
+	return kept
+}
+
+func (app *Config) ListClasses(ctx *gin.Context) {
+	classes, err := app.Models.Class.All(ctx.Query("term"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, classes)
+}
+
+func (app *Config) CreateClass(ctx *gin.Context) {
+	var requestPayload data.Class
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validateClass(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	id, err := app.Models.Class.Insert(requestPayload)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	requestPayload.ID = id
+	app.audit(ctx, auditClassCreated, "class/"+id, nil, requestPayload)
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Class %s created", id),
+		"id":      id,
+	})
+}
+
+func (app *Config) GetClass(ctx *gin.Context) {
+	class, err := app.Models.Class.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Class not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, class)
+}
+
+func (app *Config) UpdateClass(ctx *gin.Context) {
+	var requestPayload data.Class
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validateClass(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	requestPayload.ID = ctx.Param("id")
+	before, _ := app.Models.Class.GetOne(requestPayload.ID)
+
+	err := requestPayload.Update()
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Class not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	after, _ := app.Models.Class.GetOne(requestPayload.ID)
+	app.audit(ctx, auditClassUpdated, "class/"+requestPayload.ID, before, after)
+
+	// a bigger class lets students in from the waitlist
+	app.promoteWaitlist(requestPayload.ID)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Class %s updated", requestPayload.ID),
+	})
+}
+
+func (app *Config) DeleteClass(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	// a class can't be removed while enrollments still point at it
+	count, err := app.Models.Enrollment.CountInClass(id, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if count > 0 {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("Class %s is used by %d enrollments", id, count),
+		})
+		return
+	}
+
+	before, _ := app.Models.Class.GetOne(id)
+
+	err = app.Models.Class.Delete(id)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Class not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.audit(ctx, auditClassDeleted, "class/"+id, before, nil)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Class %s deleted", id),
+	})
+}
+
+func (app *Config) GetClassWaitlist(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if _, err := app.Models.Class.GetOne(id); err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Class not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	entries, err := app.Models.Waitlist.ForClass(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		want []string
+	}{
+		{"no classes", nil, nil},
+		{"empty", []string{}, []string{}},
+		{"unique", []string{"a", "b"}, []string{"a", "b"}},
+		{"repeated", []string{"a", "b", "a", "a", "c", "b"}, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uniqueIDs(tt.ids); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueIDs(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination reads the page and page_size query parameters, page starts at 1
+func pagination(ctx *gin.Context) (page, pageSize int) {
+	page, err := strconv.Atoi(ctx.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err = strconv.Atoi(ctx.Query("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return page, pageSize
+}
+
+// commentErrorJSON writes the response for an error returned by the comment methods
+func commentErrorJSON(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment or comment not found"})
+	case errors.Is(err, data.ErrNotOwner):
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error":   "true",
+			"message": "You can only change your own comments",
+		})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+	}
+}
+
+// bindCommentMessage reads the message of a new or edited comment
+func bindCommentMessage(ctx *gin.Context) (string, bool) {
+	var requestPayload struct {
+		Message string `json:"message" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return "", false
+	}
+
+	message := strings.TrimSpace(requestPayload.Message)
+	if message == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "message can't be empty",
+		})
+		return "", false
+	}
+
+	return message, true
+}
+
+// findComment returns the comment with id cid of the enrollment with the given id
+func (app *Config) findComment(id, cid string) (*data.Comment, error) {
+	entry, err := app.Models.Enrollment.GetOne(id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, ok := entry.FindComment(cid)
+	if !ok {
+		return nil, data.ErrNotFound
+	}
+
+	return comment, nil
+}
+
+func (app *Config) ListComments(ctx *gin.Context) {
+	entry, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		commentErrorJSON(ctx, err)
+		return
+	}
+
+	page, pageSize := pagination(ctx)
+
+	comments := []data.Comment{}
+	start := (page - 1) * pageSize
+	if start < len(entry.Comments) {
+		end := start + pageSize
+		if end > len(entry.Comments) {
+			end = len(entry.Comments)
+		}
+		comments = entry.Comments[start:end]
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"comments":  comments,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     len(entry.Comments),
+	})
+}
+
+func (app *Config) AddComment(ctx *gin.Context) {
+	message, ok := bindCommentMessage(ctx)
+	if !ok {
+		return
+	}
+
+	comment, err := app.Models.Enrollment.AddComment(ctx.Param("id"), currentUser(ctx).Email, message)
+	if err != nil {
+		commentErrorJSON(ctx, err)
+		return
+	}
+
+	app.audit(ctx, auditCommentAdded, "enrollment/"+ctx.Param("id"), nil, comment)
+
+	ctx.JSON(http.StatusCreated, comment)
+}
+
+func (app *Config) EditComment(ctx *gin.Context) {
+	message, ok := bindCommentMessage(ctx)
+	if !ok {
+		return
+	}
+
+	before, err := app.findComment(ctx.Param("id"), ctx.Param("cid"))
+	if err != nil {
+		commentErrorJSON(ctx, err)
+		return
+	}
+
+	comment, err := app.Models.Enrollment.EditComment(ctx.Param("id"), ctx.Param("cid"), currentUser(ctx).Email, message)
+	if err != nil {
+		commentErrorJSON(ctx, err)
+		return
+	}
+
+	app.audit(ctx, auditCommentEdited, "enrollment/"+ctx.Param("id"), before, comment)
+
+	ctx.JSON(http.StatusOK, comment)
+}
+
+func (app *Config) DeleteComment(ctx *gin.Context) {
+	before, err := app.findComment(ctx.Param("id"), ctx.Param("cid"))
+	if err != nil {
+		commentErrorJSON(ctx, err)
+		return
+	}
+
+	err = app.Models.Enrollment.DeleteComment(ctx.Param("id"), ctx.Param("cid"), currentUser(ctx).Email)
+	if err != nil {
+		commentErrorJSON(ctx, err)
+		return
+	}
+
+	app.audit(ctx, auditCommentDeleted, "enrollment/"+ctx.Param("id"), before, nil)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Comment deleted",
+	})
+}
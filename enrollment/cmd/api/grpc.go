@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+	"github.com/welab2022/LCS2-Micro/enrollment/enrolls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EnrollmentServer exposes the enrollment operations over gRPC. Like RPCServer every call
+// carries an API key, checked by grpcAuth, and changes are made on behalf of the key.
+type EnrollmentServer struct {
+	enrolls.UnimplementedEnrollmentServiceServer
+	app *Config
+}
+
+// the context key grpcAuth stores the actor of a call under
+type grpcActorKey struct{}
+
+// grpcAuth checks the API key in the x-api-key metadata of every call and makes its actor
+// available to the handlers through grpcActor
+func (app *Config) grpcAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-api-key"); len(values) > 0 {
+			key = values[0]
+		}
+	}
+
+	actor, err := app.authenticateKey(key)
+	switch {
+	case errors.Is(err, errAPIKeyMissing), errors.Is(err, errAPIKeyRejected):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Unavailable, "can't check api key")
+	}
+
+	return handler(context.WithValue(ctx, grpcActorKey{}, actor), req)
+}
+
+// grpcActor returns the actor of the call set by grpcAuth
+func grpcActor(ctx context.Context) string {
+	actor, _ := ctx.Value(grpcActorKey{}).(string)
+	return actor
+}
+
+func (s *EnrollmentServer) GetEnrollment(ctx context.Context, req *enrolls.GetEnrollmentRequest) (*enrolls.Enrollment, error) {
+	entry, err := s.app.Models.Enrollment.GetOne(req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return enrollmentToProto(entry), nil
+}
+
+func (s *EnrollmentServer) ListEnrollments(ctx context.Context, req *enrolls.ListEnrollmentsRequest) (*enrolls.ListEnrollmentsResponse, error) {
+	enrollments, err := s.app.listEnrollments(RPCListArgs{
+		Status:        req.GetStatus(),
+		StudentID:     req.GetStudentId(),
+		GuardianID:    req.GetGuardianId(),
+		GuardianEmail: req.GetGuardianEmail(),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &enrolls.ListEnrollmentsResponse{}
+	for _, entry := range enrollments {
+		res.Enrollments = append(res.Enrollments, enrollmentToProto(entry))
+	}
+
+	return res, nil
+}
+
+func (s *EnrollmentServer) CreateEnrollment(ctx context.Context, req *enrolls.CreateEnrollmentRequest) (*enrolls.Enrollment, error) {
+	actor := grpcActor(ctx)
+
+	entry := enrollmentFromProto(req.GetEnrollment())
+	if err := s.app.createEnrollment(&entry, actor); err != nil {
+		return nil, grpcError(err)
+	}
+
+	s.app.recordAudit(actor, peerIP(ctx), auditEnrollmentCreated, "enrollment/"+entry.ID, nil, entry)
+
+	return enrollmentToProto(&entry), nil
+}
+
+func (s *EnrollmentServer) TransitionEnrollment(ctx context.Context, req *enrolls.TransitionEnrollmentRequest) (*enrolls.Enrollment, error) {
+	actor := grpcActor(ctx)
+
+	entry, from, err := s.app.transitionEnrollment(req.GetId(), req.GetStatus(), actor, req.GetReason())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	s.app.recordAudit(actor, peerIP(ctx), auditEnrollmentStatus, "enrollment/"+entry.ID,
+		map[string]string{"status": from}, map[string]string{"status": entry.Status, "reason": req.GetReason()})
+
+	return enrollmentToProto(entry), nil
+}
+
+// grpcError maps the errors of the enrollment operations to gRPC status codes
+func grpcError(err error) error {
+	switch {
+	case isBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, data.ErrNotFound):
+		return status.Error(codes.NotFound, "enrollment not found")
+	case errors.Is(err, data.ErrInvalidTransition):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, data.ErrStatusConflict):
+		return status.Error(codes.Aborted, err.Error())
+	default:
+		log.Println("gRPC error:", err)
+		return status.Error(codes.Internal, "internal error, db access failed")
+	}
+}
+
+// peerIP returns the address the call came from, for the audit trail
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func enrollmentToProto(entry *data.Enrollment) *enrolls.Enrollment {
+	res := &enrolls.Enrollment{
+		Id:          entry.ID,
+		StudentId:   entry.StudentID,
+		GuardianIds: entry.GuardianIDs,
+		Student: &enrolls.Student{
+			Id:       entry.Student.ID,
+			FullName: entry.Student.FullName,
+			NickName: entry.Student.NickName,
+			Dob:      entry.Student.DOB,
+			Age:      int32(entry.Student.Age),
+			Gender:   entry.Student.Gender,
+		},
+		Guardian: &enrolls.Guardian{
+			Id:          entry.Guardians.ID,
+			FullName:    entry.Guardians.FullName,
+			Email:       entry.Guardians.Email,
+			Phoneno:     entry.Guardians.PhoneNo,
+			SocialMedia: entry.Guardians.SocialMedia,
+			Address:     entry.Guardians.Address,
+		},
+		Class:        entry.Class,
+		Waitlist:     entry.Waitlist,
+		EnrolledDate: entry.EnrolledDate,
+		Status:       entry.Status,
+		Fee:          entry.Fee,
+		Currency:     entry.Currency,
+		HasSeesaw:    entry.HasSeesaw,
+		CreatedBy:    entry.CreatedBy,
+		UpdatedBy:    entry.UpdatedBy,
+		CreatedAt:    timestamppb.New(entry.CreatedAt),
+		UpdatedAt:    timestamppb.New(entry.UpdatedAt),
+	}
+
+	for _, change := range entry.History {
+		res.History = append(res.History, &enrolls.StatusChange{
+			From:   change.From,
+			To:     change.To,
+			Actor:  change.Actor,
+			Reason: change.Reason,
+			At:     timestamppb.New(change.At),
+		})
+	}
+
+	return res
+}
+
+// enrollmentFromProto returns the fields of a new enrollment a caller can set
+func enrollmentFromProto(req *enrolls.Enrollment) data.Enrollment {
+	entry := data.Enrollment{
+		StudentID:    req.GetStudentId(),
+		GuardianIDs:  req.GetGuardianIds(),
+		Class:        req.GetClass(),
+		EnrolledDate: req.GetEnrolledDate(),
+		Status:       req.GetStatus(),
+		Fee:          req.GetFee(),
+		Currency:     req.GetCurrency(),
+		HasSeesaw:    req.GetHasSeesaw(),
+	}
+
+	if student := req.GetStudent(); student != nil {
+		entry.Student = data.Student{
+			FullName: student.GetFullName(),
+			NickName: student.GetNickName(),
+			DOB:      student.GetDob(),
+			Age:      int(student.GetAge()),
+			Gender:   student.GetGender(),
+		}
+	}
+
+	if guardian := req.GetGuardian(); guardian != nil {
+		entry.Guardians = data.Guardian{
+			FullName:    guardian.GetFullName(),
+			Email:       guardian.GetEmail(),
+			PhoneNo:     guardian.GetPhoneno(),
+			SocialMedia: guardian.GetSocialMedia(),
+			Address:     guardian.GetAddress(),
+		}
+	}
+
+	return entry
+}
+
+// gRPCListen serves gRPC on gRpcPort until the process exits
+func (app *Config) gRPCListen() {
+	listen, err := net.Listen("tcp", fmt.Sprintf(":%s", gRpcPort))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(app.grpcAuth))
+	enrolls.RegisterEnrollmentServiceServer(s, &EnrollmentServer{app: app})
+
+	log.Println("Starting gRPC server on port", gRpcPort)
+
+	if err := s.Serve(listen); err != nil {
+		log.Panic(err)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
 )
 
 func (app *Config) HeartBeat(ctx *gin.Context) {
@@ -14,9 +18,349 @@ func (app *Config) HeartBeat(ctx *gin.Context) {
 	})
 }
 
+// validateEnrollment checks the fields a client must send when creating or updating an enrollment
+func validateEnrollment(entry *data.Enrollment) error {
+	if entry.Student.FullName == "" && entry.StudentID == "" {
+		return errors.New("student full_name or student_id is required")
+	}
+
+	if entry.Fee < 0 {
+		return errors.New("fee can't be negative")
+	}
+
+	if entry.Currency != "" && !validCurrency(entry.Currency) {
+		return fmt.Errorf("invalid currency %q, must be an ISO 4217 code like VND", entry.Currency)
+	}
+
+	// a class listed twice would take two seats
+	entry.Class = uniqueIDs(entry.Class)
+
+	return nil
+}
+
+// validateStatus checks the initial status of a new enrollment, defaulting to enrolled
+func validateStatus(entry *data.Enrollment) error {
+	if entry.Status == "" {
+		entry.Status = data.StatusEnrolled
+	}
+
+	if !data.ValidStatus(entry.Status) {
+		return fmt.Errorf("invalid status %q, must be one of enrolled, completed, postponed, unenrolled", entry.Status)
+	}
+
+	return nil
+}
+
 func (app *Config) ListEnroll(ctx *gin.Context) {
+	status := ctx.Query("status")
+	if status != "" && !data.ValidStatus(status) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("invalid status %q", status),
+		})
+		return
+	}
+
+	enrollments, err := app.Models.Enrollment.All(status)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollments)
+}
+
+func (app *Config) CreateEnroll(ctx *gin.Context) {
+	var requestPayload data.Enrollment
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := app.createEnrollment(&requestPayload, currentUser(ctx).Email); err != nil {
+		if isBadRequest(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	id := requestPayload.ID
+	app.audit(ctx, auditEnrollmentCreated, "enrollment/"+id, nil, requestPayload)
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status":   "success",
+		"message":  fmt.Sprintf("Enrollment %s created", id),
+		"id":       id,
+		"class":    requestPayload.Class,
+		"waitlist": requestPayload.Waitlist,
+	})
+}
+
+func (app *Config) GetEnroll(ctx *gin.Context) {
+	entry, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entry)
+}
+
+func (app *Config) UpdateEnroll(ctx *gin.Context) {
+	var requestPayload data.Enrollment
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validateEnrollment(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	current, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if requestPayload.Currency == "" {
+		requestPayload.Currency = current.Currency
+	}
+
+	// the ledger is kept in one currency
+	if requestPayload.Currency != current.Currency {
+		payments, err := app.Models.Payment.ForEnrollment(current.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+			return
+		}
+		if len(payments) > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": "Can't change the currency of an enrollment with payments",
+			})
+			return
+		}
+	}
+
+	// classes added to an enrolled student need a free seat or go on the waitlist,
+	// classes dropped free their seat for the next student in line. The classes of the
+	// other students only have to exist.
+	var added, waiting, freed, unwaited []string
+	requestPayload.Waitlist = current.Waitlist
+	wanted := requestPayload.Class
+	known := append(append([]string{}, current.Class...), current.Waitlist...)
+
+	if current.Status == data.StatusEnrolled {
+		added, waiting, err = app.seatClasses(addedIDs(known, wanted))
+		if err != nil {
+			classErrorJSON(ctx, err)
+			return
+		}
+
+		freed = addedIDs(wanted, current.Class)
+		unwaited = addedIDs(wanted, current.Waitlist)
+
+		requestPayload.Class = append(keptIDs(current.Class, wanted), added...)
+		requestPayload.Waitlist = append(keptIDs(current.Waitlist, wanted), waiting...)
+
+		for _, classID := range waiting {
+			if err := app.Models.Waitlist.Insert(classID, current.ID); err != nil {
+				app.releaseClassSeats(added)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+				return
+			}
+		}
+	} else if err := app.checkClasses(addedIDs(known, wanted)); err != nil {
+		classErrorJSON(ctx, err)
+		return
+	} else if requestPayload.Class == nil {
+		requestPayload.Class = []string{}
+	}
+
+	requestPayload.ID = current.ID
+	requestPayload.UpdatedBy = currentUser(ctx).Email
+
+	err = requestPayload.Update(current)
+	if err != nil {
+		app.releaseClassSeats(added)
+		for _, classID := range waiting {
+			if err := app.Models.Waitlist.Remove(classID, current.ID); err != nil {
+				log.Printf("Can't remove enrollment %s from waitlist of %s: %s", current.ID, classID, err)
+			}
+		}
+
+		switch {
+		case errors.Is(err, data.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+		case errors.Is(err, data.ErrChanged):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": err.Error(),
+			})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		}
+		return
+	}
+
+	for _, classID := range unwaited {
+		if err := app.Models.Waitlist.Remove(classID, current.ID); err != nil {
+			log.Printf("Can't remove enrollment %s from waitlist of %s: %s", current.ID, classID, err)
+		}
+	}
+
+	// whether the enrollment is paid up depends on the fee
+	if requestPayload.Fee != current.Fee {
+		if _, err := app.updatePaymentSummary(&requestPayload); err != nil {
+			log.Printf("Can't update the payment summary of enrollment %s: %s", current.ID, err)
+		}
+	}
+
+	if updated, err := app.Models.Enrollment.GetOne(current.ID); err == nil {
+		app.audit(ctx, auditEnrollmentUpdated, "enrollment/"+current.ID, current, updated)
+	} else {
+		app.audit(ctx, auditEnrollmentUpdated, "enrollment/"+current.ID, current, requestPayload)
+	}
+
+	app.releaseClassSeats(freed)
+	for _, classID := range freed {
+		app.promoteWaitlist(classID)
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"status":  "200",
-		"message": "List enrolls",
+		"status":   "success",
+		"message":  fmt.Sprintf("Enrollment %s updated", requestPayload.ID),
+		"class":    requestPayload.Class,
+		"waitlist": requestPayload.Waitlist,
 	})
 }
+
+func (app *Config) DeleteEnroll(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	entry, err := app.Models.Enrollment.GetOne(id)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	err = app.Models.Waitlist.RemoveEnrollment(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	err = app.Models.Enrollment.Delete(id)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.audit(ctx, auditEnrollmentDeleted, "enrollment/"+id, entry, nil)
+
+	if entry.Status == data.StatusEnrolled {
+		app.releaseClassSeats(entry.Class)
+		for _, classID := range entry.Class {
+			app.promoteWaitlist(classID)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Enrollment %s deleted", id),
+	})
+}
+
+func (app *Config) TransitionEnroll(ctx *gin.Context) {
+	var requestPayload struct {
+		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	entry, from, err := app.transitionEnrollment(ctx.Param("id"), requestPayload.Status, currentUser(ctx).Email, requestPayload.Reason)
+	if err != nil {
+		switch {
+		case isBadRequest(err):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": err.Error(),
+			})
+		case errors.Is(err, data.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+		case errors.Is(err, data.ErrInvalidTransition):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "true",
+				"message": fmt.Sprintf("Can't change status to %s", requestPayload.Status),
+			})
+		case errors.Is(err, data.ErrStatusConflict):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": err.Error(),
+			})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		}
+		return
+	}
+
+	app.audit(ctx, auditEnrollmentStatus, "enrollment/"+entry.ID,
+		gin.H{"status": from}, gin.H{"status": entry.Status, "reason": requestPayload.Reason})
+
+	ctx.JSON(http.StatusOK, entry)
+}
+
+func (app *Config) GetEnrollHistory(ctx *gin.Context) {
+	entry, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entry.History)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the gin context key the signed-in user is stored under
+const identityKey = "identity"
+
+// Identity is the signed-in staff member behind a request
+type Identity struct {
+	ID        int      `json:"id"`
+	Email     string   `json:"email"`
+	FirstName string   `json:"first_name,omitempty"`
+	LastName  string   `json:"last_name,omitempty"`
+	Roles     []string `json:"roles"`
+}
+
+// identityFromClaims builds the identity of the user an access token was issued to
+func identityFromClaims(claims *AccessClaims) *Identity {
+	id, _ := strconv.Atoi(claims.Subject)
+
+	return &Identity{
+		ID:        id,
+		Email:     claims.Email,
+		FirstName: claims.FirstName,
+		LastName:  claims.LastName,
+		Roles:     claims.Roles,
+	}
+}
+
+// currentUser returns the signed-in user set by AuthMiddleWare
+func currentUser(ctx *gin.Context) *Identity {
+	value, exists := ctx.Get(identityKey)
+	if !exists {
+		return nil
+	}
+
+	identity, _ := value.(*Identity)
+	return identity
+}
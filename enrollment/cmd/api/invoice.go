@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+// the kinds of documents we render for an enrollment
+const (
+	documentInvoice = "invoice"
+	documentReceipt = "receipt"
+)
+
+// currencyExponent is the number of minor unit digits for currencies that don't use two
+var currencyExponent = map[string]int{
+	"VND": 0,
+	"JPY": 0,
+	"KRW": 0,
+}
+
+// formatAmount renders an amount in minor units as a grouped decimal, e.g. 5,500,000 VND
+func formatAmount(amount int64, currency string) string {
+	exponent, ok := currencyExponent[currency]
+	if !ok {
+		exponent = 2
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	for len(digits) <= exponent {
+		digits = "0" + digits
+	}
+
+	whole, fraction := digits[:len(digits)-exponent], digits[len(digits)-exponent:]
+
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(r)
+	}
+
+	if fraction != "" {
+		return fmt.Sprintf("%s%s.%s %s", sign, grouped.String(), fraction, currency)
+	}
+	return fmt.Sprintf("%s%s %s", sign, grouped.String(), currency)
+}
+
+// renderDocument draws the invoice or receipt of an enrollment as a one page PDF. The classes
+// the student waits for a seat in are listed apart from the ones they are seated in.
+func (app *Config) renderDocument(kind string, entry *data.Enrollment, ledger *ledgerResponse, classes, waitlisted []*data.Class) ([]byte, error) {
+	title := "Invoice"
+	if kind == documentReceipt {
+		title = "Receipt"
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(fmt.Sprintf("%s %s", title, entry.ID), true)
+	pdf.SetCreator("LCS2 enrollment service", true)
+	pdf.AddUTF8Font("Arial", "", fontPath)
+	pdf.AddPage()
+
+	line := func(label, value string) {
+		pdf.SetFont("Arial", "", 11)
+		pdf.CellFormat(50, 7, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 7, value, "", 1, "L", false, 0, "")
+	}
+
+	pdf.SetFont("Arial", "", 22)
+	pdf.CellFormat(0, 12, title, "", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("No. %s - issued %s", entry.ID, GetNow().Format("2006-01-02")), "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	line("Student", entry.Student.FullName)
+	if entry.Student.DOB != "" {
+		line("Date of birth", entry.Student.DOB)
+	}
+	line("Guardian", entry.Guardians.FullName)
+	if entry.Guardians.Email != "" {
+		line("Email", entry.Guardians.Email)
+	}
+	if entry.Guardians.PhoneNo != "" {
+		line("Phone", entry.Guardians.PhoneNo)
+	}
+	if entry.Guardians.Address != "" {
+		line("Address", entry.Guardians.Address)
+	}
+	line("Enrolled", entry.EnrolledDate)
+	pdf.Ln(6)
+
+	// classes
+	pdf.SetFont("Arial", "", 11)
+	pdf.SetFillColor(230, 230, 230)
+	classTable := func(heading string, classes []*data.Class) {
+		pdf.CellFormat(70, 8, heading, "1", 0, "L", true, 0, "")
+		pdf.CellFormat(50, 8, "Teacher", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(0, 8, "Schedule", "1", 1, "L", true, 0, "")
+		for _, class := range classes {
+			pdf.CellFormat(70, 8, class.Name, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(50, 8, class.Teacher, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(0, 8, class.Schedule, "1", 1, "L", false, 0, "")
+		}
+		pdf.Ln(6)
+	}
+
+	classTable("Class", classes)
+	if len(waitlisted) > 0 {
+		classTable("Waitlisted, no seat yet", waitlisted)
+	}
+
+	balance := ledger.Balance
+
+	if kind == documentReceipt {
+		pdf.CellFormat(40, 8, "Date", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(30, 8, "Type", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(50, 8, "Method", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(0, 8, "Amount", "1", 1, "R", true, 0, "")
+		for _, p := range ledger.Payments {
+			amount := p.Amount
+			if p.Kind == data.PaymentKindRefund {
+				amount = -amount
+			}
+			pdf.CellFormat(40, 8, p.PaidAt.Format("2006-01-02"), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(30, 8, p.Kind, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(50, 8, p.Method, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(0, 8, formatAmount(amount, p.Currency), "1", 1, "R", false, 0, "")
+		}
+		pdf.Ln(6)
+	}
+
+	line("Fee", formatAmount(balance.Fee, balance.Currency))
+	line("Paid", formatAmount(balance.NetPaid(), balance.Currency))
+	line("Outstanding", formatAmount(balance.Outstanding, balance.Currency))
+
+	status := "Unpaid"
+	if entry.HasPaid == "yes" {
+		status = "Paid"
+		if entry.PaidDate != "" {
+			status = fmt.Sprintf("Paid on %s", entry.PaidDate)
+		}
+	} else if balance.NetPaid() > 0 {
+		status = "Partially paid"
+	}
+	pdf.Ln(4)
+	pdf.SetFont("Arial", "", 16)
+	pdf.CellFormat(0, 10, status, "", 1, "L", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (app *Config) GetInvoice(ctx *gin.Context) {
+	app.serveDocument(ctx, documentInvoice)
+}
+
+func (app *Config) GetReceipt(ctx *gin.Context) {
+	app.serveDocument(ctx, documentReceipt)
+}
+
+// serveDocument renders an invoice or receipt for the enrollment in the url
+func (app *Config) serveDocument(ctx *gin.Context, kind string) {
+	entry, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ledger, err := app.ledger(entry)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	classes, err := app.documentClasses(entry.Class)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	waitlisted, err := app.documentClasses(entry.Waitlist)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	pdf, err := app.renderDocument(kind, entry, ledger, classes, waitlisted)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": fmt.Sprintf("Can't render %s: %s", kind, err)})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s-%s.pdf"`, kind, entry.ID))
+	ctx.Header("Last-Modified", entry.UpdatedAt.UTC().Format(time.RFC1123))
+	ctx.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// documentClasses loads the classes with the given ids for an invoice or receipt
+func (app *Config) documentClasses(ids []string) ([]*data.Class, error) {
+	var classes []*data.Class
+	for _, id := range ids {
+		class, err := app.Models.Class.GetOne(id)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				// classes from before the catalog existed are shown by id
+				classes = append(classes, &data.Class{Name: id})
+				continue
+			}
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+
+	return classes, nil
+}
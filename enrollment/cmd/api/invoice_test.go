@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{0, "VND", "0 VND"},
+		{0, "USD", "0.00 USD"},
+		{5500000, "VND", "5,500,000 VND"},
+		{123456, "USD", "1,234.56 USD"},
+		{-250000, "VND", "-250,000 VND"},
+		{-123456, "USD", "-1,234.56 USD"},
+		{5, "USD", "0.05 USD"},
+		{-5, "EUR", "-0.05 EUR"},
+		{99, "EUR", "0.99 EUR"},
+		{100, "JPY", "100 JPY"},
+		{1234, "XYZ", "12.34 XYZ"},
+	}
+
+	for _, tt := range tests {
+		if got := formatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("formatAmount(%d, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
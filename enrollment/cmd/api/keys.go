@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// the issuer of the access tokens, see the authentication service
+const tokenIssuer = "lcs2-authentication"
+
+// unknown key ids make the key set refetch the JWKS, but not more often than this
+const keyRefreshInterval = time.Minute
+
+var errUnknownKey = errors.New("access token signed with an unknown key")
+
+// AccessClaims is what an access token of the authentication service says about its user
+type AccessClaims struct {
+	Email     string   `json:"email"`
+	FirstName string   `json:"first_name,omitempty"`
+	LastName  string   `json:"last_name,omitempty"`
+	Roles     []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// KeySet caches the public keys the authentication service publishes as a JWKS,
+// so access tokens are verified locally
+type KeySet struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Verify checks the signature, issuer and lifetime of an access token and returns its claims
+func (k *KeySet) Verify(accessToken string) (*AccessClaims, error) {
+	var claims AccessClaims
+
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return k.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(tokenIssuer, true) {
+		return nil, errors.New("access token has an unexpected issuer")
+	}
+
+	return &claims, nil
+}
+
+// key returns the public key with id kid, refetching the JWKS when it's not known yet
+func (k *KeySet) key(kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(k.fetchedAt) < keyRefreshInterval {
+		return nil, errUnknownKey
+	}
+
+	if err := k.fetch(); err != nil {
+		return nil, err
+	}
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, errUnknownKey
+}
+
+// fetch replaces the cached keys with the current JWKS, k.mu must be held
+func (k *KeySet) fetch() error {
+	k.fetchedAt = time.Now()
+
+	response, err := k.client.Get(k.url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: status %d", k.url, response.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	k.keys = keys
+
+	return nil
+}
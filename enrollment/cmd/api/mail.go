@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+type mailMessage struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+// sendMail posts a message to the mail service's /send endpoint
+func (app *Config) sendMail(mail mailMessage) error {
+
+	jsonData, _ := json.MarshalIndent(mail, "", "\t")
+	request, err := http.NewRequest("POST", mailServiceURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("newMessage: sendMail failed %s", err)
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-KEY", mailAPIKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		log.Printf("http: sendMail failed %s", err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("mail service responded with %d", response.StatusCode)
+	}
+
+	return nil
+}
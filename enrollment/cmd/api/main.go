@@ -13,7 +13,9 @@ import (
 var client *mongo.Client
 
 type Config struct {
-	Models data.Models
+	Models  data.Models
+	Keys    *KeySet
+	APIKeys *APIKeys
 }
 
 func main() {
@@ -35,9 +37,37 @@ func main() {
 		}
 	}()
 
+	loadEnv()
+
+	// the keys are shared by every listener, they are set up before any of them starts
 	app := Config{
-		Models: data.New(client),
+		Models:  data.New(client),
+		Keys:    NewKeySet(authServiceURL + "/.well-known/jwks.json"),
+		APIKeys: NewAPIKeys(authServiceURL + "/apikeys/verify"),
+	}
+
+	// the same student or guardian can't be stored twice, existing duplicates have to be
+	// merged by hand before the indexes can be created
+	if err := app.Models.Student.EnsureIndexes(); err != nil {
+		log.Println("Can't create the unique index of the students:", err)
 	}
+	if err := app.Models.Guardian.EnsureIndexes(); err != nil {
+		log.Println("Can't create the unique indexes of the guardians:", err)
+	}
+
+	// the classes stored before seats were counted get their count from their enrollments
+	if err := app.Models.Class.CountSeats(); err != nil {
+		log.Println("Can't count the seats of the classes:", err)
+	}
+
+	// so do the enrollments stored before the net amount paid was kept on them
+	if err := app.Models.Enrollment.CountNetPaid(); err != nil {
+		log.Println("Can't count the net amount paid of the enrollments:", err)
+	}
+
+	// the services of the stack call enrollment directly on these
+	go app.rpcListen()
+	go app.gRPCListen()
 
 	app.startApp()
 
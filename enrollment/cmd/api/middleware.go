@@ -1,13 +1,17 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleWare() gin.HandlerFunc {
+// AuthMiddleWare checks the API key of the client with the authentication service and the access token of the signed-in user.
+// The user is made available to the handlers through currentUser.
+func (app *Config) AuthMiddleWare() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		if c.GetHeader("X-API-KEY") == "" {
@@ -19,7 +23,8 @@ func AuthMiddleWare() gin.HandlerFunc {
 			return
 		}
 
-		if c.GetHeader("X-API-KEY") != os.Getenv("X_API_KEY") {
+		err := app.APIKeys.Verify(c.GetHeader("X-API-KEY"))
+		if errors.Is(err, errAPIKeyRejected) {
 			c.JSON(http.StatusNotAcceptable, gin.H{
 				"error":   "true",
 				"message": "Key is mismatched!",
@@ -27,6 +32,33 @@ func AuthMiddleWare() gin.HandlerFunc {
 			c.AbortWithStatus(401)
 			return
 		}
+		if err != nil {
+			log.Printf("AuthMiddleWare: %s", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Can't check api key"})
+			return
+		}
+
+		authorization := c.GetHeader("Authorization")
+		accessToken := strings.TrimPrefix(authorization, "Bearer ")
+		if accessToken == authorization || accessToken == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "true",
+				"message": "You must sign in first",
+			})
+			return
+		}
+
+		claims, err := app.Keys.Verify(accessToken)
+		if err != nil {
+			log.Printf("AuthMiddleWare: %s", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "true",
+				"message": "Access token is not valid, please refresh it",
+			})
+			return
+		}
+
+		c.Set(identityKey, identityFromClaims(claims))
 		c.Next()
 	}
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+// the operations shared by the HTTP, net/rpc and gRPC APIs, each API maps their errors
+// to its own responses
+
+// badRequestError is an error caused by what the caller sent, its message is meant for the caller
+type badRequestError struct {
+	error
+}
+
+func (e badRequestError) Unwrap() error {
+	return e.error
+}
+
+// isBadRequest reports whether err was caused by what the caller sent
+func isBadRequest(err error) bool {
+	var badRequest badRequestError
+	return errors.As(err, &badRequest) || errors.Is(err, errUnknownClass) ||
+		errors.Is(err, errUnknownStudent) || errors.Is(err, errUnknownGuardian)
+}
+
+// createEnrollment validates and stores a new enrollment made by actor, setting its id.
+// Its classes must exist, but only enrolled students take a seat, full classes put them
+// on the waitlist.
+func (app *Config) createEnrollment(entry *data.Enrollment, actor string) error {
+	if err := validateEnrollment(entry); err != nil {
+		return badRequestError{err}
+	}
+
+	if err := validateStatus(entry); err != nil {
+		return badRequestError{err}
+	}
+
+	// comments are added through their own endpoint, stamped with the signed-in user. They
+	// are stored as an empty array, $push can't add to a null.
+	entry.Comments = []data.Comment{}
+	entry.CreatedBy = actor
+	entry.UpdatedBy = actor
+
+	if err := app.resolvePeople(entry); err != nil {
+		return err
+	}
+
+	// class and waitlist are stored as arrays even when empty, Promote can't add to a null
+	if entry.Class == nil {
+		entry.Class = []string{}
+	}
+	entry.Waitlist = []string{}
+	if entry.Status == data.StatusEnrolled {
+		seated, waiting, err := app.seatClasses(entry.Class)
+		if err != nil {
+			return err
+		}
+		entry.Class = seated
+		entry.Waitlist = waiting
+	} else if err := app.checkClasses(entry.Class); err != nil {
+		return err
+	}
+
+	id, err := app.Models.Enrollment.Insert(*entry)
+	if err != nil {
+		if entry.Status == data.StatusEnrolled {
+			app.releaseClassSeats(entry.Class)
+		}
+		return err
+	}
+	entry.ID = id
+
+	for _, classID := range entry.Waitlist {
+		if err := app.Models.Waitlist.Insert(classID, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transitionEnrollment moves the enrollment with the given id to status on behalf of actor,
+// and returns it with the status it had before
+func (app *Config) transitionEnrollment(id, status, actor, reason string) (*data.Enrollment, string, error) {
+	if !data.ValidStatus(status) {
+		return nil, "", badRequestError{fmt.Errorf("invalid status %q", status)}
+	}
+
+	entry, err := app.Models.Enrollment.GetOne(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	from := entry.Status
+	if !data.CanTransition(from, status) {
+		return nil, "", data.ErrInvalidTransition
+	}
+
+	// seats follow the status. Coming back to enrolled takes them first, so they are written
+	// with the status. Leaving enrolled keeps every class on the enrollment, so the student
+	// can come back, and frees the seats once the status is written.
+	class, waitlist := entry.Class, entry.Waitlist
+	var seated []string
+
+	switch {
+	case from == data.StatusEnrolled:
+		class = append(append([]string{}, entry.Class...), entry.Waitlist...)
+		waitlist = []string{}
+	case status == data.StatusEnrolled:
+		seated, waitlist, err = app.seatClasses(append(append([]string{}, entry.Class...), entry.Waitlist...))
+		if err != nil {
+			return nil, "", err
+		}
+		class = seated
+	}
+
+	updated, err := app.Models.Enrollment.Transition(entry, status, actor, reason, class, waitlist)
+	if err != nil {
+		app.releaseClassSeats(seated)
+		return nil, "", err
+	}
+
+	switch {
+	case from == data.StatusEnrolled:
+		app.leaveClasses(updated.ID, entry.Class)
+	case status == data.StatusEnrolled:
+		app.joinWaitlists(updated.ID, waitlist)
+	}
+
+	return updated, from, nil
+}
+
+// guardianEnrollments returns the enrollments of the guardian with the given id
+func (app *Config) guardianEnrollments(guardianID string) ([]*data.Enrollment, error) {
+	guardian, err := app.Models.Guardian.GetOne(guardianID)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.Models.Enrollment.ForGuardian(guardian.ID, guardian.StudentIDs)
+}
+
+// guardianEnrollmentsByEmail returns the enrollments of the guardian with the given email,
+// ErrNotFound when there is no such guardian
+func (app *Config) guardianEnrollmentsByEmail(email string) ([]*data.Enrollment, error) {
+	guardian, err := app.Models.Guardian.FindDuplicate(data.Guardian{Email: email})
+	if err != nil {
+		return nil, err
+	}
+
+	return app.Models.Enrollment.ForGuardian(guardian.ID, guardian.StudentIDs)
+}
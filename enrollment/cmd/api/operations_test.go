@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateEnrollment_ThenAddComment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("comments", func(mt *mtest.T) {
+		app := Config{Models: data.New(mt.Client)}
+
+		studentID := primitive.NewObjectID()
+		enrollmentID := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			// the student of the enrollment
+			mtest.CreateCursorResponse(0, "enrollment.students", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: studentID},
+				{Key: "full_name", Value: "Student One"},
+			}),
+			// the insert of the enrollment
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		entry := data.Enrollment{StudentID: studentID.Hex(), Status: data.StatusPostponed}
+		if err := app.createEnrollment(&entry, "staff@example.com"); err != nil {
+			mt.Fatal(err)
+		}
+
+		insert := lastCommand(mt, "insert")
+		comments := insert.Lookup("documents", "0", "comments")
+		if comments.Type != bsontype.Array {
+			mt.Fatalf("the enrollment is stored with comments %s, want an array", comments.Type)
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			// a null comments field made an array
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			// the comment pushed
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		comment, err := app.Models.Enrollment.AddComment(enrollmentID.Hex(), "staff@example.com", "first call done")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if comment.Message != "first call done" || comment.User != "staff@example.com" {
+			mt.Errorf("unexpected comment %+v", comment)
+		}
+
+		update := lastCommand(mt, "update")
+		pushed := update.Lookup("updates", "0", "u", "$push", "comments", "message")
+		if pushed.StringValue() != "first call done" {
+			mt.Errorf("the comment isn't pushed: %s", update)
+		}
+	})
+}
+
+// lastCommand returns the last command named name sent to the mock deployment
+func lastCommand(mt *mtest.T, name string) bson.Raw {
+	mt.Helper()
+
+	var command bson.Raw
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName == name {
+			command = started.Command
+		}
+	}
+
+	if command == nil {
+		mt.Fatalf("no %s was sent", name)
+	}
+
+	return command
+}
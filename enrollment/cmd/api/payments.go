@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+// validCurrency checks for a three letter upper case ISO 4217 code
+func validCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+type ledgerResponse struct {
+	Payments []*data.Payment `json:"payments"`
+	Balance  data.Balance    `json:"balance"`
+}
+
+// ledger loads the payments of an enrollment and computes its balance
+func (app *Config) ledger(entry *data.Enrollment) (*ledgerResponse, error) {
+	payments, err := app.Models.Payment.ForEnrollment(entry.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := entry.Currency
+	if currency == "" {
+		currency = data.DefaultCurrency
+	}
+
+	return &ledgerResponse{
+		Payments: payments,
+		Balance:  data.ComputeBalance(entry.Fee, currency, payments),
+	}, nil
+}
+
+// updatePaymentSummary brings the payment fields of an enrollment in line with its ledger
+// and fee, after either changed, and returns the ledger
+func (app *Config) updatePaymentSummary(entry *data.Enrollment) (*ledgerResponse, error) {
+	ledger, err := app.ledger(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastPaid time.Time
+	for _, p := range ledger.Payments {
+		if p.Kind == data.PaymentKindPayment && p.PaidAt.After(lastPaid) {
+			lastPaid = p.PaidAt
+		}
+	}
+
+	if err := app.Models.Enrollment.SetPaymentSummary(entry.ID, ledger.Balance, lastPaid); err != nil {
+		return nil, err
+	}
+
+	return ledger, nil
+}
+
+func (app *Config) ListPayments(ctx *gin.Context) {
+	entry, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ledger, err := app.ledger(entry)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ledger)
+}
+
+func (app *Config) RecordPayment(ctx *gin.Context) {
+	app.recordLedgerEntry(ctx, data.PaymentKindPayment)
+}
+
+func (app *Config) RecordRefund(ctx *gin.Context) {
+	app.recordLedgerEntry(ctx, data.PaymentKindRefund)
+}
+
+// recordLedgerEntry adds a payment or a refund to the ledger of an enrollment
+// and returns the new balance
+func (app *Config) recordLedgerEntry(ctx *gin.Context, kind string) {
+	var requestPayload struct {
+		Amount    int64     `json:"amount" binding:"required"`
+		Currency  string    `json:"currency"`
+		Method    string    `json:"method"`
+		Reference string    `json:"reference"`
+		Note      string    `json:"note"`
+		PaidAt    time.Time `json:"paid_at"`
+	}
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if requestPayload.Amount <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "amount must be a positive number of minor currency units",
+		})
+		return
+	}
+
+	entry, err := app.Models.Enrollment.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ledger, err := app.ledger(entry)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	currency := strings.ToUpper(requestPayload.Currency)
+	if currency == "" {
+		currency = ledger.Balance.Currency
+	}
+
+	if currency != ledger.Balance.Currency {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("currency must be %s", ledger.Balance.Currency),
+		})
+		return
+	}
+
+	// the net amount paid is checked and moved in one update, before the ledger entry is added
+	delta := requestPayload.Amount
+	if kind == data.PaymentKindRefund {
+		delta = -delta
+	}
+
+	err = app.Models.Enrollment.AddNetPaid(entry.ID, delta)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRefundTooLarge):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "true",
+				"message": fmt.Sprintf("Can't refund more than the %d %s paid", ledger.Balance.NetPaid(), currency),
+			})
+		case errors.Is(err, data.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Enrollment not found"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		}
+		return
+	}
+
+	payment := data.Payment{
+		EnrollmentID: entry.ID,
+		Kind:         kind,
+		Amount:       requestPayload.Amount,
+		Currency:     currency,
+		Method:       requestPayload.Method,
+		Reference:    requestPayload.Reference,
+		Note:         requestPayload.Note,
+		RecordedBy:   currentUser(ctx).Email,
+		PaidAt:       requestPayload.PaidAt,
+	}
+
+	id, err := app.Models.Payment.Insert(payment)
+	if err != nil {
+		if err := app.Models.Enrollment.AddNetPaid(entry.ID, -delta); err != nil {
+			log.Printf("Can't take back %d from the net amount paid of enrollment %s: %s", delta, entry.ID, err)
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	action := auditPaymentRecorded
+	if kind == data.PaymentKindRefund {
+		action = auditRefundRecorded
+	}
+	payment.ID = id
+	app.audit(ctx, action, "enrollment/"+entry.ID, nil, payment)
+
+	ledger, err = app.updatePaymentSummary(entry)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("%s %s recorded", kind, id),
+		"id":      id,
+		"balance": ledger.Balance,
+	})
+}
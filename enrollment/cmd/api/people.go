@@ -0,0 +1,477 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+var (
+	errUnknownStudent  = errors.New("student does not exist")
+	errUnknownGuardian = errors.New("guardian does not exist")
+)
+
+// findOrCreateGuardian returns the stored guardian with the same email or phone number,
+// or stores a new one. created tells which of the two happened.
+func (app *Config) findOrCreateGuardian(guardian data.Guardian) (stored *data.Guardian, created bool, err error) {
+	existing, err := app.Models.Guardian.FindDuplicate(guardian)
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, data.ErrNotFound) {
+		return nil, false, err
+	}
+
+	// another request may have stored the same person since
+	id, err := app.Models.Guardian.Insert(guardian)
+	if errors.Is(err, data.ErrDuplicate) {
+		existing, err := app.Models.Guardian.FindDuplicate(guardian)
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	stored, err = app.Models.Guardian.GetOne(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return stored, true, nil
+}
+
+// findOrCreateStudent returns the stored student with the same name and date of birth,
+// or stores a new one. created tells which of the two happened.
+func (app *Config) findOrCreateStudent(student data.Student) (stored *data.Student, created bool, err error) {
+	existing, err := app.Models.Student.FindDuplicate(student)
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, data.ErrNotFound) {
+		return nil, false, err
+	}
+
+	// another request may have stored the same person since
+	id, err := app.Models.Student.Insert(student)
+	if errors.Is(err, data.ErrDuplicate) {
+		existing, err := app.Models.Student.FindDuplicate(student)
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	stored, err = app.Models.Student.GetOne(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return stored, true, nil
+}
+
+// resolvePeople links a new enrollment to its student and guardian records. Ids sent by
+// the client must exist; embedded student and guardian data is matched against the
+// stored records and only stored when it is new.
+func (app *Config) resolvePeople(entry *data.Enrollment) error {
+	var student *data.Student
+	var err error
+
+	if entry.StudentID != "" {
+		student, err = app.Models.Student.GetOne(entry.StudentID)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				return fmt.Errorf("%w: %s", errUnknownStudent, entry.StudentID)
+			}
+			return err
+		}
+	} else {
+		student, _, err = app.findOrCreateStudent(entry.Student.Snapshot())
+		if err != nil {
+			return err
+		}
+	}
+
+	guardianIDs := entry.GuardianIDs
+	if len(guardianIDs) == 0 && (entry.Guardians.Email != "" || entry.Guardians.PhoneNo != "") {
+		guardian, _, err := app.findOrCreateGuardian(entry.Guardians.Snapshot())
+		if err != nil {
+			return err
+		}
+		guardianIDs = []string{guardian.ID}
+	}
+
+	for i, id := range guardianIDs {
+		guardian, err := app.Models.Guardian.GetOne(id)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				return fmt.Errorf("%w: %s", errUnknownGuardian, id)
+			}
+			return err
+		}
+
+		// the first guardian is the contact stored with the enrollment
+		if i == 0 {
+			entry.Guardians = guardian.Snapshot()
+		}
+
+		if err := app.Models.Guardian.Link(guardian.ID, student.ID); err != nil {
+			return err
+		}
+	}
+
+	entry.StudentID = student.ID
+	entry.Student = student.Snapshot()
+	entry.GuardianIDs = append(guardianIDs, addedIDs(guardianIDs, student.GuardianIDs)...)
+
+	return nil
+}
+
+// peopleErrorJSON writes the response for an error returned by resolvePeople
+func peopleErrorJSON(ctx *gin.Context, err error) {
+	if errors.Is(err, errUnknownStudent) || errors.Is(err, errUnknownGuardian) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+}
+
+func (app *Config) ListStudents(ctx *gin.Context) {
+	students, err := app.Models.Student.All()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, students)
+}
+
+func (app *Config) CreateStudent(ctx *gin.Context) {
+	var requestPayload data.Student
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if requestPayload.FullName == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "full_name is required",
+		})
+		return
+	}
+
+	student, created, err := app.findOrCreateStudent(requestPayload.Snapshot())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	for _, guardianID := range requestPayload.GuardianIDs {
+		if err := app.Models.Guardian.Link(guardianID, student.ID); err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				peopleErrorJSON(ctx, fmt.Errorf("%w: %s", errUnknownGuardian, guardianID))
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+			return
+		}
+	}
+
+	if !created {
+		ctx.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("Student %s already exists", student.ID),
+			"id":      student.ID,
+		})
+		return
+	}
+
+	app.audit(ctx, auditStudentCreated, "student/"+student.ID, nil, student)
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Student %s created", student.ID),
+		"id":      student.ID,
+	})
+}
+
+func (app *Config) GetStudent(ctx *gin.Context) {
+	student, err := app.Models.Student.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, student)
+}
+
+func (app *Config) UpdateStudent(ctx *gin.Context) {
+	var requestPayload data.Student
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if requestPayload.FullName == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "full_name is required",
+		})
+		return
+	}
+
+	requestPayload.ID = ctx.Param("id")
+	before, _ := app.Models.Student.GetOne(requestPayload.ID)
+
+	err := requestPayload.Update()
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+			return
+		}
+		if errors.Is(err, data.ErrDuplicate) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": "Another student has the same name and date of birth",
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	after, _ := app.Models.Student.GetOne(requestPayload.ID)
+	app.audit(ctx, auditStudentUpdated, "student/"+requestPayload.ID, before, after)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Student %s updated", requestPayload.ID),
+	})
+}
+
+func (app *Config) GetStudentEnrollments(ctx *gin.Context) {
+	student, err := app.Models.Student.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	enrollments, err := app.Models.Enrollment.ForStudent(student.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollments)
+}
+
+func (app *Config) ListGuardians(ctx *gin.Context) {
+	guardians, err := app.Models.Guardian.All()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, guardians)
+}
+
+func (app *Config) CreateGuardian(ctx *gin.Context) {
+	var requestPayload data.Guardian
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if requestPayload.Email == "" && requestPayload.PhoneNo == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "email or phoneno is required",
+		})
+		return
+	}
+
+	guardian, created, err := app.findOrCreateGuardian(requestPayload.Snapshot())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	if !created {
+		ctx.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("Guardian %s already exists", guardian.ID),
+			"id":      guardian.ID,
+		})
+		return
+	}
+
+	app.audit(ctx, auditGuardianCreated, "guardian/"+guardian.ID, nil, guardian)
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Guardian %s created", guardian.ID),
+		"id":      guardian.ID,
+	})
+}
+
+func (app *Config) GetGuardian(ctx *gin.Context) {
+	guardian, err := app.Models.Guardian.GetOne(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Guardian not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, guardian)
+}
+
+func (app *Config) UpdateGuardian(ctx *gin.Context) {
+	var requestPayload data.Guardian
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// the guardian must stay reachable
+	if strings.TrimSpace(requestPayload.Email) == "" && data.NormalizePhone(requestPayload.PhoneNo) == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": "email or phoneno is required",
+		})
+		return
+	}
+
+	requestPayload.ID = ctx.Param("id")
+
+	// the new contact details must not belong to another guardian
+	existing, err := app.Models.Guardian.FindDuplicate(requestPayload)
+	if err == nil && existing.ID != requestPayload.ID {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("Email or phone number already used by guardian %s", existing.ID),
+		})
+		return
+	}
+	if err != nil && !errors.Is(err, data.ErrNotFound) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	before, _ := app.Models.Guardian.GetOne(requestPayload.ID)
+
+	err = requestPayload.Update()
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Guardian not found"})
+			return
+		}
+		if errors.Is(err, data.ErrDuplicate) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "true",
+				"message": "Email or phone number already used by another guardian",
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	after, _ := app.Models.Guardian.GetOne(requestPayload.ID)
+	app.audit(ctx, auditGuardianUpdated, "guardian/"+requestPayload.ID, before, after)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Guardian %s updated", requestPayload.ID),
+	})
+}
+
+func (app *Config) LinkStudent(ctx *gin.Context) {
+	guardianID, studentID := ctx.Param("id"), ctx.Param("sid")
+
+	err := app.Models.Guardian.Link(guardianID, studentID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Guardian or student not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.audit(ctx, auditGuardianLinked, "guardian/"+guardianID, nil, gin.H{"student_id": studentID})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Guardian %s linked to student %s", guardianID, studentID),
+	})
+}
+
+func (app *Config) UnlinkStudent(ctx *gin.Context) {
+	guardianID, studentID := ctx.Param("id"), ctx.Param("sid")
+
+	err := app.Models.Guardian.Unlink(guardianID, studentID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Guardian or student not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	app.audit(ctx, auditGuardianUnlinked, "guardian/"+guardianID, gin.H{"student_id": studentID}, nil)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("Guardian %s unlinked from student %s", guardianID, studentID),
+	})
+}
+
+func (app *Config) GetGuardianEnrollments(ctx *gin.Context) {
+	enrollments, err := app.guardianEnrollments(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Guardian not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollments)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// permissions checked on the enrollment routes
+const (
+	PermEnrollRead    = "enroll:read"
+	PermEnrollWrite   = "enroll:write"
+	PermClassesWrite  = "classes:write"
+	PermPaymentsRead  = "payments:read"
+	PermPaymentsWrite = "payments:write"
+	PermCommentsWrite = "comments:write"
+)
+
+// rolePermissions maps the roles of the authentication service to what they may do here
+var rolePermissions = map[string][]string{
+	"admin": {
+		PermEnrollRead, PermEnrollWrite, PermClassesWrite,
+		PermPaymentsRead, PermPaymentsWrite, PermCommentsWrite,
+	},
+	"staff":      {PermEnrollRead, PermEnrollWrite, PermClassesWrite, PermPaymentsRead, PermCommentsWrite},
+	"teacher":    {PermEnrollRead, PermCommentsWrite},
+	"accountant": {PermEnrollRead, PermPaymentsRead, PermPaymentsWrite},
+	"read-only":  {PermEnrollRead, PermPaymentsRead},
+}
+
+// HasPermission reports whether one of the roles of the signed-in user grants perm
+func (identity *Identity) HasPermission(perm string) bool {
+	for _, role := range identity.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// RequirePermission rejects requests whose signed-in user lacks perm,
+// it must run after AuthMiddleWare
+func (app *Config) RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := currentUser(c)
+		if identity == nil || !identity.HasPermission(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "true",
+				"message": "No permission, " + perm + " is required",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
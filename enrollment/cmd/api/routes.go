@@ -9,14 +9,48 @@ import (
 )
 
 var (
-	webPort  = "80"
-	rpcPort  = "5001"
-	mongoURL = "mongodb://mongo:27017"
-	gRpcPort = "50001"
+	webPort        = "80"
+	rpcPort        = "5001"
+	mongoURL       = "mongodb://mongo:27017"
+	gRpcPort       = "50001"
+	mailServiceURL = "http://host.docker.internal:9001/send"
+	// the mail service only queues mail sent with an API key issued for the mail scope
+	mailAPIKey     string
+	fontPath       = "/app/Arial.ttf"
+	authServiceURL = "http://host.docker.internal:9000"
+	// the audit trail of the stack, the logger isn't published so this is its name in compose
+	auditServiceURL = "http://logger-service/audit"
 )
 
 const GROUP_ENROL_API = "/api/enroll/"
 
+// loadEnv reads the addresses of the service and of the services it calls, and the key it
+// calls the mail service with, from the environment. It runs before any listener starts,
+// they all read them.
+func loadEnv() {
+	if os.Getenv("MAIL_SERVICE_URL") != "" {
+		mailServiceURL = os.Getenv("MAIL_SERVICE_URL")
+	}
+
+	mailAPIKey = os.Getenv("MAIL_API_KEY")
+
+	if os.Getenv("AUTH_SERVICE_URL") != "" {
+		authServiceURL = os.Getenv("AUTH_SERVICE_URL")
+	}
+
+	if os.Getenv("AUDIT_SERVICE_URL") != "" {
+		auditServiceURL = os.Getenv("AUDIT_SERVICE_URL")
+	}
+
+	if os.Getenv("FONT_PATH") != "" {
+		fontPath = os.Getenv("FONT_PATH")
+	}
+
+	if os.Getenv("ENROLL_PORT") != "" {
+		webPort = os.Getenv("ENROLL_PORT")
+	}
+}
+
 func (app *Config) startApp() {
 
 	router := gin.New()
@@ -26,8 +60,8 @@ func (app *Config) startApp() {
 	router.Use(cors.Default())
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"OPIONS, GET, PUT, POST, DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
+		AllowMethods:     []string{"OPTIONS", "GET", "PUT", "POST", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-KEY"},
 		ExposeHeaders:    []string{"Content-Length, Link"},
 		MaxAge:           12 * time.Hour,
 		AllowCredentials: true,
@@ -37,14 +71,50 @@ func (app *Config) startApp() {
 
 	// auth with middleware
 	authorized := router.Group("/")
-	authorized.Use(AuthMiddleWare())
+	authorized.Use(app.AuthMiddleWare())
 	{
+		read := app.RequirePermission(PermEnrollRead)
+		write := app.RequirePermission(PermEnrollWrite)
+
 		// map to URL
-		authorized.GET("/list", app.ListEnroll)
-	}
+		authorized.GET("/list", read, app.ListEnroll)
+		authorized.POST("/enroll", write, app.CreateEnroll)
+		authorized.GET("/enroll/:id", read, app.GetEnroll)
+		authorized.PUT("/enroll/:id", write, app.UpdateEnroll)
+		authorized.DELETE("/enroll/:id", write, app.DeleteEnroll)
+		authorized.POST("/enroll/:id/transition", write, app.TransitionEnroll)
+		authorized.GET("/enroll/:id/history", read, app.GetEnrollHistory)
+		authorized.GET("/enroll/:id/payments", app.RequirePermission(PermPaymentsRead), app.ListPayments)
+		authorized.POST("/enroll/:id/payments", app.RequirePermission(PermPaymentsWrite), app.RecordPayment)
+		authorized.POST("/enroll/:id/refunds", app.RequirePermission(PermPaymentsWrite), app.RecordRefund)
+		authorized.GET("/enroll/:id/invoice.pdf", app.RequirePermission(PermPaymentsRead), app.GetInvoice)
+		authorized.GET("/enroll/:id/receipt.pdf", app.RequirePermission(PermPaymentsRead), app.GetReceipt)
+		authorized.GET("/enroll/:id/comments", read, app.ListComments)
+		authorized.POST("/enroll/:id/comments", app.RequirePermission(PermCommentsWrite), app.AddComment)
+		authorized.PUT("/enroll/:id/comments/:cid", app.RequirePermission(PermCommentsWrite), app.EditComment)
+		authorized.DELETE("/enroll/:id/comments/:cid", app.RequirePermission(PermCommentsWrite), app.DeleteComment)
 
-	if os.Getenv("ENROLL_PORT") != "" {
-		webPort = os.Getenv("ENROLL_PORT")
+		authorized.GET("/classes", read, app.ListClasses)
+		authorized.POST("/class", app.RequirePermission(PermClassesWrite), app.CreateClass)
+		authorized.GET("/class/:id", read, app.GetClass)
+		authorized.PUT("/class/:id", app.RequirePermission(PermClassesWrite), app.UpdateClass)
+		authorized.DELETE("/class/:id", app.RequirePermission(PermClassesWrite), app.DeleteClass)
+		authorized.GET("/class/:id/waitlist", read, app.GetClassWaitlist)
+
+		authorized.GET("/students", read, app.ListStudents)
+		authorized.POST("/student", write, app.CreateStudent)
+		authorized.GET("/student/:id", read, app.GetStudent)
+		authorized.PUT("/student/:id", write, app.UpdateStudent)
+		authorized.GET("/student/:id/enrollments", read, app.GetStudentEnrollments)
+
+		authorized.GET("/guardians", read, app.ListGuardians)
+		authorized.POST("/guardian", write, app.CreateGuardian)
+		authorized.GET("/guardian/:id", read, app.GetGuardian)
+		authorized.PUT("/guardian/:id", write, app.UpdateGuardian)
+		authorized.GET("/guardian/:id/enrollments", read, app.GetGuardianEnrollments)
+		authorized.POST("/guardian/:id/student/:sid", write, app.LinkStudent)
+		authorized.DELETE("/guardian/:id/student/:sid", write, app.UnlinkStudent)
 	}
+
 	router.Run(":" + webPort)
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+// RPCServer exposes the enrollment operations over Go net/rpc, for the services of the stack
+// that call enrollment directly instead of through the api gateway. Every call carries an API
+// key with the enrollment scope, changes are made on behalf of the key.
+type RPCServer struct {
+	app *Config
+}
+
+// RPCGetArgs names the enrollment GetEnrollment replies with
+type RPCGetArgs struct {
+	APIKey string
+	ID     string
+}
+
+// RPCListArgs selects the enrollments ListEnrollments returns. At most one of StudentID,
+// GuardianID and GuardianEmail is used, in that order, otherwise all the enrollments with Status.
+type RPCListArgs struct {
+	APIKey        string
+	Status        string
+	StudentID     string
+	GuardianID    string
+	GuardianEmail string
+}
+
+// RPCCreateArgs is a new enrollment
+type RPCCreateArgs struct {
+	APIKey     string
+	Enrollment data.Enrollment
+}
+
+// RPCTransitionArgs is a status change of an enrollment
+type RPCTransitionArgs struct {
+	APIKey string
+	ID     string
+	Status string
+	Reason string
+}
+
+// GetEnrollment replies with the enrollment with the given id
+func (r *RPCServer) GetEnrollment(args RPCGetArgs, reply *data.Enrollment) error {
+	if _, err := r.app.authenticateKey(args.APIKey); err != nil {
+		return rpcKeyError(err)
+	}
+
+	entry, err := r.app.Models.Enrollment.GetOne(args.ID)
+	if err != nil {
+		return rpcError(err)
+	}
+
+	*reply = *entry
+	return nil
+}
+
+// ListEnrollments replies with the enrollments args selects
+func (r *RPCServer) ListEnrollments(args RPCListArgs, reply *[]*data.Enrollment) error {
+	if _, err := r.app.authenticateKey(args.APIKey); err != nil {
+		return rpcKeyError(err)
+	}
+
+	enrollments, err := r.app.listEnrollments(args)
+	if err != nil {
+		return rpcError(err)
+	}
+
+	*reply = enrollments
+	return nil
+}
+
+// CreateEnrollment stores a new enrollment and replies with it, as stored
+func (r *RPCServer) CreateEnrollment(args RPCCreateArgs, reply *data.Enrollment) error {
+	actor, err := r.app.authenticateKey(args.APIKey)
+	if err != nil {
+		return rpcKeyError(err)
+	}
+
+	entry := args.Enrollment
+	if err := r.app.createEnrollment(&entry, actor); err != nil {
+		return rpcError(err)
+	}
+
+	r.app.recordAudit(actor, "", auditEnrollmentCreated, "enrollment/"+entry.ID, nil, entry)
+
+	*reply = entry
+	return nil
+}
+
+// TransitionEnrollment changes the status of an enrollment and replies with it
+func (r *RPCServer) TransitionEnrollment(args RPCTransitionArgs, reply *data.Enrollment) error {
+	actor, err := r.app.authenticateKey(args.APIKey)
+	if err != nil {
+		return rpcKeyError(err)
+	}
+
+	entry, from, err := r.app.transitionEnrollment(args.ID, args.Status, actor, args.Reason)
+	if err != nil {
+		return rpcError(err)
+	}
+
+	r.app.recordAudit(actor, "", auditEnrollmentStatus, "enrollment/"+entry.ID,
+		map[string]string{"status": from}, map[string]string{"status": entry.Status, "reason": args.Reason})
+
+	*reply = *entry
+	return nil
+}
+
+// listEnrollments returns the enrollments args selects
+func (app *Config) listEnrollments(args RPCListArgs) ([]*data.Enrollment, error) {
+	if args.Status != "" && !data.ValidStatus(args.Status) {
+		return nil, badRequestError{fmt.Errorf("invalid status %q", args.Status)}
+	}
+
+	switch {
+	case args.StudentID != "":
+		return app.Models.Enrollment.ForStudent(args.StudentID)
+	case args.GuardianID != "":
+		return app.guardianEnrollments(args.GuardianID)
+	case args.GuardianEmail != "":
+		return app.guardianEnrollmentsByEmail(args.GuardianEmail)
+	default:
+		return app.Models.Enrollment.All(args.Status)
+	}
+}
+
+// rpcError hides the errors that aren't the caller's, net/rpc sends only their message
+func rpcError(err error) error {
+	switch {
+	case isBadRequest(err), errors.Is(err, data.ErrNotFound),
+		errors.Is(err, data.ErrInvalidTransition), errors.Is(err, data.ErrStatusConflict):
+		return err
+	default:
+		log.Println("RPC error:", err)
+		return errors.New("internal error, db access failed")
+	}
+}
+
+// rpcKeyError tells the caller why its API key wasn't accepted
+func rpcKeyError(err error) error {
+	if errors.Is(err, errAPIKeyMissing) || errors.Is(err, errAPIKeyRejected) {
+		return err
+	}
+
+	return errors.New("can't check api key")
+}
+
+// rpcListen serves net/rpc on rpcPort until the process exits
+func (app *Config) rpcListen() {
+	if err := rpc.RegisterName("RPCServer", &RPCServer{app: app}); err != nil {
+		log.Panic(err)
+	}
+
+	listen, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", rpcPort))
+	if err != nil {
+		log.Panic(err)
+	}
+	defer listen.Close()
+
+	log.Println("Starting RPC server on port", rpcPort)
+
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			log.Println("RPC accept error:", err)
+			continue
+		}
+		go rpc.ServeConn(conn)
+	}
+}
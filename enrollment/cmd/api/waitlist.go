@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/welab2022/LCS2-Micro/enrollment/data"
+)
+
+// joinWaitlists puts a newly enrolled student in line for the classes that were full
+func (app *Config) joinWaitlists(enrollmentID string, classIDs []string) {
+	for _, classID := range classIDs {
+		if err := app.Models.Waitlist.Insert(classID, enrollmentID); err != nil {
+			log.Printf("Can't put enrollment %s on the waitlist of %s: %s", enrollmentID, classID, err)
+		}
+	}
+}
+
+// leaveClasses takes a student who is no longer enrolled off every waitlist and hands the
+// seats they had to the next students in line
+func (app *Config) leaveClasses(enrollmentID string, seated []string) {
+	if err := app.Models.Waitlist.RemoveEnrollment(enrollmentID); err != nil {
+		// the entries left behind are skipped when their turn comes
+		log.Printf("Can't remove enrollment %s from the waitlists: %s", enrollmentID, err)
+	}
+
+	app.releaseClassSeats(seated)
+	for _, classID := range seated {
+		app.promoteWaitlist(classID)
+	}
+}
+
+// promoteWaitlist moves students from the waitlist into a class for as long as it has
+// free seats, and lets their guardians know
+func (app *Config) promoteWaitlist(classID string) {
+	class, err := app.Models.Class.GetOne(classID)
+	if err != nil {
+		log.Printf("promoteWaitlist: can't load class %s: %s", classID, err)
+		return
+	}
+
+	for {
+		// the seat is taken first, so no other request can hand it out in the meantime
+		err := app.Models.Class.TakeSeat(classID)
+		if err != nil {
+			if !errors.Is(err, data.ErrClassFull) {
+				log.Printf("promoteWaitlist: can't take a seat of %s: %s", classID, err)
+			}
+			return
+		}
+
+		entry, err := app.promoteNext(classID)
+		if err != nil {
+			app.releaseClassSeats([]string{classID})
+			if !errors.Is(err, data.ErrNotFound) {
+				log.Printf("promoteWaitlist: can't promote from the waitlist of %s: %s", classID, err)
+			}
+			return
+		}
+
+		log.Printf("Enrollment %s promoted from the waitlist into class %s", entry.ID, classID)
+
+		go app.notifyPromotion(entry, class)
+	}
+}
+
+// promoteNext moves the first enrollment in line into a class it has a seat for, skipping
+// the stale entries. It returns ErrNotFound when nobody is waiting.
+func (app *Config) promoteNext(classID string) (*data.Enrollment, error) {
+	for {
+		next, err := app.Models.Waitlist.PopNext(classID)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := app.Models.Enrollment.Promote(next.EnrollmentID, classID)
+		if errors.Is(err, data.ErrNotFound) {
+			// stale entry, the enrollment isn't enrolled or waiting for the class anymore
+			log.Printf("promoteWaitlist: skipping enrollment %s of class %s", next.EnrollmentID, classID)
+			continue
+		}
+		if err != nil {
+			// the enrollment keeps its place in line for the next free seat
+			if err := app.Models.Waitlist.Restore(next); err != nil {
+				log.Printf("promoteWaitlist: can't put enrollment %s back on the waitlist of %s: %s",
+					next.EnrollmentID, classID, err)
+			}
+			return nil, err
+		}
+
+		return entry, nil
+	}
+}
+
+// notifyPromotion emails the guardian that the student got a seat
+func (app *Config) notifyPromotion(entry *data.Enrollment, class *data.Class) {
+	if entry.Guardians.Email == "" {
+		return
+	}
+
+	var mail mailMessage
+	mail.To = entry.Guardians.Email
+	mail.Subject = fmt.Sprintf("A seat is available in %s", class.Name)
+	mail.Message = fmt.Sprintf("Hello %s,\n %s has been moved from the waitlist into the class %s (%s).",
+		entry.Guardians.FullName, entry.Student.FullName, class.Name, class.Schedule)
+
+	err := app.sendMail(mail)
+	if err != nil {
+		log.Printf("notifyPromotion: can't email %s: %s", mail.To, err)
+	}
+}
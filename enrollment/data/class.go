@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrClassFull is returned when a class has no free seat left
+var ErrClassFull = errors.New("class is full")
+
+// Class is one course in the catalog that students enroll into. Taken counts the seats of
+// the enrolled students, it is only changed with TakeSeat and ReleaseSeat.
+type Class struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string    `bson:"name" json:"name"`
+	Teacher   string    `bson:"teacher" json:"teacher"`
+	Schedule  string    `bson:"schedule" json:"schedule"`
+	Capacity  int       `bson:"capacity" json:"capacity"`
+	Taken     int       `bson:"taken" json:"taken"`
+	Term      string    `bson:"term" json:"term"`
+	Room      string    `bson:"room" json:"room"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func classCollection() *mongo.Collection {
+	return client.Database("enrollment").Collection("classes")
+}
+
+// Insert stores a new class and returns its id
+func (c *Class) Insert(class Class) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	class.ID = ""
+	class.Taken = 0
+	class.CreatedAt = time.Now()
+	class.UpdatedAt = time.Now()
+
+	result, err := classCollection().InsertOne(ctx, class)
+	if err != nil {
+		log.Println("Error inserting into classes:", err)
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// All returns every class sorted by term and name. An empty term returns all terms.
+func (c *Class) All(term string) ([]*Class, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if term != "" {
+		filter["term"] = term
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "term", Value: 1}, {Key: "name", Value: 1}})
+
+	cursor, err := classCollection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("Finding all classes error:", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	classes := []*Class{}
+
+	for cursor.Next(ctx) {
+		var item Class
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding class into slice:", err)
+			return nil, err
+		}
+		classes = append(classes, &item)
+	}
+
+	return classes, nil
+}
+
+// GetOne returns one class by id
+func (c *Class) GetOne(id string) (*Class, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var class Class
+	err = classCollection().FindOne(ctx, bson.M{"_id": docID}).Decode(&class)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &class, nil
+}
+
+// Update saves the receiver over the stored class with the same id
+func (c *Class) Update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := classCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "name", Value: c.Name},
+				{Key: "teacher", Value: c.Teacher},
+				{Key: "schedule", Value: c.Schedule},
+				{Key: "capacity", Value: c.Capacity},
+				{Key: "term", Value: c.Term},
+				{Key: "room", Value: c.Room},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete removes one class by id
+func (c *Class) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := classCollection().DeleteOne(ctx, bson.M{"_id": docID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// TakeSeat takes one free seat of a class. The check and the count are one update, so two
+// students can't get the last seat. It returns ErrClassFull when no seat is free.
+func (c *Class) TakeSeat(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := classCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "$expr": bson.M{"$lt": bson.A{"$taken", "$capacity"}}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "taken", Value: 1}}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := c.GetOne(id); err != nil {
+			return err
+		}
+		return ErrClassFull
+	}
+
+	return nil
+}
+
+// ReleaseSeat frees one seat of a class
+func (c *Class) ReleaseSeat(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	_, err = classCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "taken": bson.M{"$gt": 0}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "taken", Value: -1}}},
+		},
+	)
+
+	return err
+}
+
+// CountSeats sets the seat count of the classes stored before seats were counted, from
+// their enrolled students. It is run once at startup.
+func (c *Class) CountSeats() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cursor, err := classCollection().Find(ctx, bson.M{"taken": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var class Class
+		if err := cursor.Decode(&class); err != nil {
+			return err
+		}
+
+		taken, err := enrollmentCollection().CountDocuments(ctx, bson.M{"class": class.ID, "status": StatusEnrolled})
+		if err != nil {
+			return err
+		}
+
+		docID, _ := primitive.ObjectIDFromHex(class.ID)
+		_, err = classCollection().UpdateOne(ctx,
+			bson.M{"_id": docID, "taken": bson.M{"$exists": false}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "taken", Value: taken}}}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
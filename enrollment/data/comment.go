@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotOwner is returned when a user changes a comment written by someone else
+var ErrNotOwner = errors.New("comment belongs to another user")
+
+// Comment is one message in the comment thread of an enrollment. User is the
+// signed-in staff member who wrote it; earlier versions are kept in Edits. A deleted
+// comment is only marked with DeletedAt, so its history stays.
+type Comment struct {
+	ID          string        `bson:"id" json:"id"`
+	User        string        `bson:"user" json:"user"`
+	Message     string        `bson:"message" json:"message"`
+	DateCreated time.Time     `bson:"dateCreated" json:"dateCreated"`
+	DateUpdated time.Time     `bson:"dateUpdated,omitempty" json:"dateUpdated,omitempty"`
+	Edits       []CommentEdit `bson:"edits,omitempty" json:"edits,omitempty"`
+	DeletedAt   *time.Time    `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+// CommentEdit is a previous version of a comment
+type CommentEdit struct {
+	Message  string    `bson:"message" json:"message"`
+	EditedAt time.Time `bson:"editedAt" json:"editedAt"`
+}
+
+// the layouts dateCreated was stored in while it was a string, as in enrolls.json
+var commentDateLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// UnmarshalBSON reads a comment, also the ones stored with dateCreated as a string. A date
+// that can't be read is left zero, the stored value isn't changed.
+func (c *Comment) UnmarshalBSON(data []byte) error {
+	var stored struct {
+		ID          string        `bson:"id"`
+		User        string        `bson:"user"`
+		Message     string        `bson:"message"`
+		DateCreated bson.RawValue `bson:"dateCreated"`
+		DateUpdated time.Time     `bson:"dateUpdated,omitempty"`
+		Edits       []CommentEdit `bson:"edits,omitempty"`
+		DeletedAt   *time.Time    `bson:"deleted_at,omitempty"`
+	}
+
+	if err := bson.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	*c = Comment{
+		ID:          stored.ID,
+		User:        stored.User,
+		Message:     stored.Message,
+		DateCreated: commentDate(stored.DateCreated),
+		DateUpdated: stored.DateUpdated,
+		Edits:       stored.Edits,
+		DeletedAt:   stored.DeletedAt,
+	}
+
+	return nil
+}
+
+// commentDate returns the time of a stored dateCreated, a date or a string
+func commentDate(value bson.RawValue) time.Time {
+	switch value.Type {
+	case bsontype.DateTime:
+		return value.Time()
+	case bsontype.String:
+		for _, layout := range commentDateLayouts {
+			if t, err := time.Parse(layout, value.StringValue()); err == nil {
+				return t
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// FindComment returns the comment with the given id from an enrollment, unless it was deleted
+func (e *Enrollment) FindComment(commentID string) (*Comment, bool) {
+	for i := range e.Comments {
+		if e.Comments[i].ID == commentID && e.Comments[i].DeletedAt == nil {
+			return &e.Comments[i], true
+		}
+	}
+	return nil, false
+}
+
+// VisibleComments returns the comments of an enrollment that weren't deleted
+func (e *Enrollment) VisibleComments() []Comment {
+	comments := []Comment{}
+	for _, comment := range e.Comments {
+		if comment.DeletedAt == nil {
+			comments = append(comments, comment)
+		}
+	}
+	return comments
+}
+
+// AddComment appends a comment to the thread of an enrollment and returns it
+func (e *Enrollment) AddComment(enrollmentID, user, message string) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(enrollmentID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	comment := Comment{
+		ID:          primitive.NewObjectID().Hex(),
+		User:        user,
+		Message:     message,
+		DateCreated: time.Now(),
+	}
+
+	// enrollments created before the comments were stored as an array hold null, which
+	// $push can't add to
+	_, err = enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "comments": nil},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "comments", Value: bson.A{}}}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID},
+		bson.D{{Key: "$push", Value: bson.D{{Key: "comments", Value: comment}}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &comment, nil
+}
+
+// EditComment replaces the message of a comment written by user and keeps the
+// previous message in its edit history
+func (e *Enrollment) EditComment(enrollmentID, commentID, user, message string) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	entry, err := e.GetOne(enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, ok := entry.FindComment(commentID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if comment.User != user {
+		return nil, ErrNotOwner
+	}
+
+	now := time.Now()
+	edit := CommentEdit{
+		Message:  comment.Message,
+		EditedAt: now,
+	}
+
+	docID, _ := primitive.ObjectIDFromHex(enrollmentID)
+
+	// matching the old message makes a concurrent edit fail instead of losing history
+	result, err := enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{
+			"_id": docID,
+			"comments": bson.M{"$elemMatch": bson.M{
+				"id":         commentID,
+				"user":       user,
+				"message":    comment.Message,
+				"deleted_at": bson.M{"$exists": false},
+			}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "comments.$.message", Value: message},
+				{Key: "comments.$.dateUpdated", Value: now},
+			}},
+			{Key: "$push", Value: bson.D{
+				{Key: "comments.$.edits", Value: edit},
+			}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, ErrNotFound
+	}
+
+	comment.Message = message
+	comment.DateUpdated = now
+	comment.Edits = append(comment.Edits, edit)
+
+	return comment, nil
+}
+
+// DeleteComment marks a comment written by user as deleted. It is kept, with its
+// edit history, but no longer listed or changed.
+func (e *Enrollment) DeleteComment(enrollmentID, commentID, user string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	entry, err := e.GetOne(enrollmentID)
+	if err != nil {
+		return err
+	}
+
+	comment, ok := entry.FindComment(commentID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	if comment.User != user {
+		return ErrNotOwner
+	}
+
+	docID, _ := primitive.ObjectIDFromHex(enrollmentID)
+
+	result, err := enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{
+			"_id": docID,
+			"comments": bson.M{"$elemMatch": bson.M{
+				"id":         commentID,
+				"user":       user,
+				"deleted_at": bson.M{"$exists": false},
+			}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "comments.$.deleted_at", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestComment_UnmarshalBSON(t *testing.T) {
+	created := time.Date(2021, 1, 17, 18, 28, 52, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		dateCreated interface{}
+		want        time.Time
+	}{
+		{"date", created, created},
+		{"rfc 3339 string", "2021-01-17T19:28:52+01:00", created},
+		{"date and time string", "2021-01-17 18:28:52", created},
+		{"date string", "2021-01-17", time.Date(2021, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"placeholder of enrolls.json", "DATE_TIME", time.Time{}},
+		{"missing", nil, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := bson.M{"id": "c1", "user": "staff", "message": "TEXT"}
+			if tt.dateCreated != nil {
+				doc["dateCreated"] = tt.dateCreated
+			}
+
+			encoded, err := bson.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var comment Comment
+			if err := bson.Unmarshal(encoded, &comment); err != nil {
+				t.Fatalf("can't read the comment: %s", err)
+			}
+
+			if !comment.DateCreated.Equal(tt.want) {
+				t.Errorf("DateCreated = %s, want %s", comment.DateCreated, tt.want)
+			}
+			if comment.ID != "c1" || comment.User != "staff" || comment.Message != "TEXT" {
+				t.Errorf("unexpected comment %+v", comment)
+			}
+		})
+	}
+}
+
+func TestComment_RoundTrip(t *testing.T) {
+	deleted := time.Now().UTC().Truncate(time.Millisecond)
+	comment := Comment{
+		ID:          "c1",
+		User:        "staff",
+		Message:     "new",
+		DateCreated: deleted.Add(-time.Hour),
+		Edits:       []CommentEdit{{Message: "old", EditedAt: deleted.Add(-time.Minute)}},
+		DeletedAt:   &deleted,
+	}
+
+	encoded, err := bson.Marshal(comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Comment
+	if err := bson.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.DateCreated.Equal(comment.DateCreated) || len(decoded.Edits) != 1 ||
+		decoded.DeletedAt == nil || !decoded.DeletedAt.Equal(deleted) {
+		t.Errorf("got %+v back, want %+v", decoded, comment)
+	}
+}
+
+func TestEnrollment_DeletedComments(t *testing.T) {
+	deleted := time.Now()
+	entry := Enrollment{Comments: []Comment{
+		{ID: "c1", Message: "kept"},
+		{ID: "c2", Message: "deleted", DeletedAt: &deleted},
+	}}
+
+	if visible := entry.VisibleComments(); len(visible) != 1 || visible[0].ID != "c1" {
+		t.Errorf("VisibleComments = %+v, want only c1", visible)
+	}
+
+	if _, ok := entry.FindComment("c2"); ok {
+		t.Error("FindComment found the deleted comment")
+	}
+	if comment, ok := entry.FindComment("c1"); !ok || comment.Message != "kept" {
+		t.Errorf("FindComment(c1) = %+v, %v", comment, ok)
+	}
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotFound is returned when no document matches the requested id
+var ErrNotFound = errors.New("document not found")
+
+// ErrDuplicate is returned when a unique index rejects a document, the same person was
+// stored by another request
+var ErrDuplicate = errors.New("document already exists")
+
+// ErrChanged is returned when an enrollment was changed by another request since it was read
+var ErrChanged = errors.New("enrollment was changed by another request")
+
+// Enrollment is one student enrolled into one or more classes, see enrolls.json.
+// Student and Guardians are a snapshot taken at enrollment time, the linked
+// records live in their own collections under StudentID and GuardianIDs. NetPaid is the
+// ledger's payments minus its refunds, it is only changed with AddNetPaid.
+type Enrollment struct {
+	ID           string         `bson:"_id,omitempty" json:"id,omitempty"`
+	StudentID    string         `bson:"student_id,omitempty" json:"student_id,omitempty"`
+	GuardianIDs  []string       `bson:"guardian_ids,omitempty" json:"guardian_ids,omitempty"`
+	Student      Student        `bson:"student" json:"student"`
+	Guardians    Guardian       `bson:"guardians" json:"guardians"`
+	Class        []string       `bson:"class" json:"class"`
+	Waitlist     []string       `bson:"waitlist" json:"waitlist"`
+	EnrolledDate string         `bson:"enrolled_date" json:"enrolled_date"`
+	CreatedBy    string         `bson:"created_by" json:"created_by"`
+	UpdatedBy    string         `bson:"updated_by" json:"updated_by"`
+	CreatedAt    time.Time      `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time      `bson:"updated_at" json:"updated_at"`
+	Status       string         `bson:"status" json:"status"`
+	Comments     []Comment      `bson:"comments" json:"comments"`
+	HasSeesaw    string         `bson:"has_seesaw" json:"has_seesaw"`
+	HasPaid      string         `bson:"has_paid" json:"has_paid"`
+	PaidDate     string         `bson:"paid_date" json:"paid_date"`
+	PaidAmount   string         `bson:"paid_amount" json:"paid_amount"`
+	Fee          int64          `bson:"fee" json:"fee"`
+	NetPaid      int64          `bson:"net_paid" json:"-"`
+	Currency     string         `bson:"currency" json:"currency"`
+	ActLog       string         `bson:"act_log" json:"act_log"`
+	History      []StatusChange `bson:"history" json:"history"`
+}
+
+func enrollmentCollection() *mongo.Collection {
+	return client.Database("enrollment").Collection("enrollments")
+}
+
+// Insert stores a new enrollment and returns its id
+func (e *Enrollment) Insert(entry Enrollment) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	entry.ID = ""
+	entry.NetPaid = 0
+	if entry.Currency == "" {
+		entry.Currency = DefaultCurrency
+	}
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+	entry.History = []StatusChange{
+		{
+			To:     entry.Status,
+			Actor:  entry.CreatedBy,
+			Reason: "created",
+			At:     entry.CreatedAt,
+		},
+	}
+
+	result, err := enrollmentCollection().InsertOne(ctx, entry)
+	if err != nil {
+		log.Println("Error inserting into enrollments:", err)
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// All returns every enrollment, newest first. An empty status returns all statuses.
+func (e *Enrollment) All(status string) ([]*Enrollment, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	return e.find(filter)
+}
+
+// GetOne returns one enrollment by id, without its deleted comments
+func (e *Enrollment) GetOne(id string) (*Enrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var entry Enrollment
+	err = enrollmentCollection().FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	entry.Comments = entry.VisibleComments()
+
+	return &entry, nil
+}
+
+// Update saves the receiver over the stored enrollment with the same id, as long as its
+// status, classes and waitlist are still the ones of read. It returns ErrChanged otherwise.
+// The creation fields are left untouched, the status can only be changed with Transition,
+// the payment fields follow the payment ledger and comments have their own endpoints.
+func (e *Enrollment) Update(read *Enrollment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(e.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "status": read.Status, "class": read.Class, "waitlist": read.Waitlist},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "student", Value: e.Student},
+				{Key: "guardians", Value: e.Guardians},
+				{Key: "class", Value: e.Class},
+				{Key: "waitlist", Value: e.Waitlist},
+				{Key: "enrolled_date", Value: e.EnrolledDate},
+				{Key: "updated_by", Value: e.UpdatedBy},
+				{Key: "has_seesaw", Value: e.HasSeesaw},
+				{Key: "act_log", Value: e.ActLog},
+				{Key: "fee", Value: e.Fee},
+				{Key: "currency", Value: e.Currency},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrChanged
+	}
+
+	return nil
+}
+
+// Delete removes one enrollment by id
+func (e *Enrollment) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := enrollmentCollection().DeleteOne(ctx, bson.M{"_id": docID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CountInClass returns how many enrollments reference classID. With an empty status
+// every enrollment is counted, otherwise only the ones in that status.
+func (e *Enrollment) CountInClass(classID, status string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	filter := bson.M{"class": classID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	return enrollmentCollection().CountDocuments(ctx, filter)
+}
+
+// Promote moves classID from the waitlist of an enrolled enrollment into its classes and
+// returns the updated enrollment. It returns ErrNotFound if the enrollment is no longer
+// enrolled or waiting for that class.
+func (e *Enrollment) Promote(id, classID string) (*Enrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	opts := options.FindOneAndUpdate()
+	opts.SetReturnDocument(options.After)
+
+	var entry Enrollment
+	err = enrollmentCollection().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": docID, "status": StatusEnrolled, "waitlist": classID},
+		bson.D{
+			{Key: "$pull", Value: bson.D{{Key: "waitlist", Value: classID}}},
+			{Key: "$addToSet", Value: bson.D{{Key: "class", Value: classID}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+		},
+		opts,
+	).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// ForGuardian returns every enrollment of the students of a guardian, newest first
+func (e *Enrollment) ForGuardian(guardianID string, studentIDs []string) ([]*Enrollment, error) {
+	if studentIDs == nil {
+		studentIDs = []string{}
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"guardian_ids": guardianID},
+		bson.M{"student_id": bson.M{"$in": studentIDs}},
+	}}
+
+	return e.find(filter)
+}
+
+// ForStudent returns every enrollment of a student, newest first
+func (e *Enrollment) ForStudent(studentID string) ([]*Enrollment, error) {
+	return e.find(bson.M{"student_id": studentID})
+}
+
+// find returns the enrollments matching filter, newest first, without their deleted comments
+func (e *Enrollment) find(filter bson.M) ([]*Enrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := enrollmentCollection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("Finding enrollments error:", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	enrollments := []*Enrollment{}
+
+	for cursor.Next(ctx) {
+		var item Enrollment
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding enrollment into slice:", err)
+			return nil, err
+		}
+		item.Comments = item.VisibleComments()
+		enrollments = append(enrollments, &item)
+	}
+
+	return enrollments, nil
+}
@@ -0,0 +1,301 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Guardian is one parent or guardian in the guardians collection. The same shape
+// is embedded into enrollments, without the id and the links.
+type Guardian struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	FullName    string    `bson:"full_name" json:"full_name"`
+	Email       string    `bson:"email" json:"email"`
+	PhoneNo     string    `bson:"phoneno" json:"phoneno"`
+	SocialMedia string    `bson:"social_media" json:"social_media"`
+	Address     string    `bson:"address" json:"address"`
+	StudentIDs  []string  `bson:"student_ids,omitempty" json:"student_ids,omitempty"`
+	CreatedAt   time.Time `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// Snapshot returns the guardian without id, links and timestamps, as stored in an enrollment
+func (g *Guardian) Snapshot() Guardian {
+	return Guardian{
+		FullName:    g.FullName,
+		Email:       g.Email,
+		PhoneNo:     g.PhoneNo,
+		SocialMedia: g.SocialMedia,
+		Address:     g.Address,
+	}
+}
+
+// normalize lowercases the email and keeps only the digits and a leading + of the
+// phone number, so the same person is found however the contact was typed in
+func (g *Guardian) normalize() {
+	g.FullName = strings.TrimSpace(g.FullName)
+	g.Email = strings.ToLower(strings.TrimSpace(g.Email))
+	g.PhoneNo = NormalizePhone(g.PhoneNo)
+}
+
+// NormalizePhone strips everything but digits and a leading + from a phone number
+func NormalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+
+	var b strings.Builder
+	for i, r := range phone {
+		if unicode.IsDigit(r) || (i == 0 && r == '+') {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func guardianCollection() *mongo.Collection {
+	return client.Database("enrollment").Collection("guardians")
+}
+
+// EnsureIndexes makes the email and the phone number of a guardian unique, when they are
+// given. It fails while the collection holds duplicates.
+func (g *Guardian) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := guardianCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().
+				SetName("unique_email").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{Key: "phoneno", Value: 1}},
+			Options: options.Index().
+				SetName("unique_phoneno").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"phoneno": bson.M{"$gt": ""}}),
+		},
+	})
+
+	return err
+}
+
+// Insert stores a new guardian and returns its id
+func (g *Guardian) Insert(guardian Guardian) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	guardian.ID = ""
+	guardian.normalize()
+	guardian.CreatedAt = time.Now()
+	guardian.UpdatedAt = time.Now()
+
+	result, err := guardianCollection().InsertOne(ctx, guardian)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", ErrDuplicate
+	}
+	if err != nil {
+		log.Println("Error inserting into guardians:", err)
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// FindDuplicate returns the stored guardian with the same email or phone number,
+// or ErrNotFound
+func (g *Guardian) FindDuplicate(guardian Guardian) (*Guardian, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	guardian.normalize()
+
+	var or bson.A
+	if guardian.Email != "" {
+		or = append(or, bson.M{"email": guardian.Email})
+	}
+	if guardian.PhoneNo != "" {
+		or = append(or, bson.M{"phoneno": guardian.PhoneNo})
+	}
+	if len(or) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var existing Guardian
+	err := guardianCollection().FindOne(ctx, bson.M{"$or": or}).Decode(&existing)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &existing, nil
+}
+
+// All returns every guardian sorted by name
+func (g *Guardian) All() ([]*Guardian, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "full_name", Value: 1}})
+
+	cursor, err := guardianCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		log.Println("Finding all guardians error:", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	guardians := []*Guardian{}
+
+	for cursor.Next(ctx) {
+		var item Guardian
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding guardian into slice:", err)
+			return nil, err
+		}
+		guardians = append(guardians, &item)
+	}
+
+	return guardians, nil
+}
+
+// GetOne returns one guardian by id
+func (g *Guardian) GetOne(id string) (*Guardian, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var guardian Guardian
+	err = guardianCollection().FindOne(ctx, bson.M{"_id": docID}).Decode(&guardian)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &guardian, nil
+}
+
+// Update saves the receiver over the stored guardian with the same id, links are kept
+func (g *Guardian) Update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(g.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	g.normalize()
+
+	result, err := guardianCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "full_name", Value: g.FullName},
+				{Key: "email", Value: g.Email},
+				{Key: "phoneno", Value: g.PhoneNo},
+				{Key: "social_media", Value: g.SocialMedia},
+				{Key: "address", Value: g.Address},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Link records that a guardian looks after a student, on both records
+func (g *Guardian) Link(guardianID, studentID string) error {
+	return g.setLink(guardianID, studentID, "$addToSet")
+}
+
+// Unlink removes the link between a guardian and a student from both records
+func (g *Guardian) Unlink(guardianID, studentID string) error {
+	return g.setLink(guardianID, studentID, "$pull")
+}
+
+// setLink applies op to the links of both records in one transaction, so a link is never
+// recorded on only one of them
+func (g *Guardian) setLink(guardianID, studentID, op string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	guardianDocID, err := primitive.ObjectIDFromHex(guardianID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	studentDocID, err := primitive.ObjectIDFromHex(studentID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		result, err := guardianCollection().UpdateOne(
+			sessionCtx,
+			bson.M{"_id": guardianDocID},
+			bson.D{{Key: op, Value: bson.D{{Key: "student_ids", Value: studentID}}}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrNotFound
+		}
+
+		result, err = studentCollection().UpdateOne(
+			sessionCtx,
+			bson.M{"_id": studentDocID},
+			bson.D{{Key: op, Value: bson.D{{Key: "guardian_ids", Value: guardianID}}}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrNotFound
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
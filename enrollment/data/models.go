@@ -16,12 +16,24 @@ func New(mongo *mongo.Client) Models {
 	client = mongo
 
 	return Models{
-		LogEntry: LogEntry{},
+		LogEntry:   LogEntry{},
+		Enrollment: Enrollment{},
+		Class:      Class{},
+		Waitlist:   WaitlistEntry{},
+		Student:    Student{},
+		Guardian:   Guardian{},
+		Payment:    Payment{},
 	}
 }
 
 type Models struct {
-	LogEntry LogEntry
+	LogEntry   LogEntry
+	Enrollment Enrollment
+	Class      Class
+	Waitlist   WaitlistEntry
+	Student    Student
+	Guardian   Guardian
+	Payment    Payment
 }
 
 type LogEntry struct {
@@ -49,39 +61,6 @@ func (l *LogEntry) Insert(entry LogEntry) error {
 	return nil
 }
 
-// func (l *LogEntry) All() ([]*LogEntry, error) {
-// 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-// 	defer cancel()
-
-// 	collection := client.Database("logs").Collection("logs")
-
-// 	opts := options.Find()
-// 	opts.SetSort(bson.D{{"created_at", -1}})
-
-// 	cursor, err := collection.Find(context.TODO(), bson.D{}, opts)
-// 	if err != nil {
-// 		log.Println("Finding all docs error:", err)
-// 		return nil, err
-// 	}
-// 	defer cursor.Close(ctx)
-
-// 	var logs []*LogEntry
-
-// 	for cursor.Next(ctx) {
-// 		var item LogEntry
-
-// 		err := cursor.Decode(&item)
-// 		if err != nil {
-// 			log.Print("Error decoding log into slice:", err)
-// 			return nil, err
-// 		} else {
-// 			logs = append(logs, &item)
-// 		}
-// 	}
-
-// 	return logs, nil
-// }
-
 func (l *LogEntry) GetOne(id string) (*LogEntry, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
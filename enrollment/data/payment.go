@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the kinds of entries in the payment ledger
+const (
+	PaymentKindPayment = "payment"
+	PaymentKindRefund  = "refund"
+)
+
+// ErrRefundTooLarge is returned when a refund is larger than what is left of the payments
+var ErrRefundTooLarge = errors.New("refund larger than the amount paid")
+
+// DefaultCurrency is used for enrollments created without a currency
+const DefaultCurrency = "VND"
+
+// Payment is one entry of the payment ledger of an enrollment. Amount is always
+// positive and in the minor unit of Currency; Kind tells whether money came in or
+// went back out.
+type Payment struct {
+	ID           string    `bson:"_id,omitempty" json:"id,omitempty"`
+	EnrollmentID string    `bson:"enrollment_id" json:"enrollment_id"`
+	Kind         string    `bson:"kind" json:"kind"`
+	Amount       int64     `bson:"amount" json:"amount"`
+	Currency     string    `bson:"currency" json:"currency"`
+	Method       string    `bson:"method" json:"method"`
+	Reference    string    `bson:"reference" json:"reference"`
+	Note         string    `bson:"note" json:"note"`
+	RecordedBy   string    `bson:"recorded_by" json:"recorded_by"`
+	PaidAt       time.Time `bson:"paid_at" json:"paid_at"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Balance sums up the ledger of an enrollment against its fee
+type Balance struct {
+	Currency    string `json:"currency"`
+	Fee         int64  `json:"fee"`
+	Paid        int64  `json:"paid"`
+	Refunded    int64  `json:"refunded"`
+	Outstanding int64  `json:"outstanding"`
+}
+
+// NetPaid is what was paid minus what was refunded
+func (b *Balance) NetPaid() int64 {
+	return b.Paid - b.Refunded
+}
+
+// Settled reports whether something was paid and nothing is left to pay
+func (b *Balance) Settled() bool {
+	return b.NetPaid() > 0 && b.Outstanding <= 0
+}
+
+// ComputeBalance adds up a ledger for an enrollment fee
+func ComputeBalance(fee int64, currency string, payments []*Payment) Balance {
+	balance := Balance{
+		Currency: currency,
+		Fee:      fee,
+	}
+
+	for _, p := range payments {
+		switch p.Kind {
+		case PaymentKindPayment:
+			balance.Paid += p.Amount
+		case PaymentKindRefund:
+			balance.Refunded += p.Amount
+		}
+	}
+
+	balance.Outstanding = balance.Fee - balance.NetPaid()
+
+	return balance
+}
+
+func paymentCollection() *mongo.Collection {
+	return client.Database("enrollment").Collection("payments")
+}
+
+// Insert adds an entry to the ledger and returns its id
+func (p *Payment) Insert(payment Payment) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	payment.ID = ""
+	payment.CreatedAt = time.Now()
+	if payment.PaidAt.IsZero() {
+		payment.PaidAt = payment.CreatedAt
+	}
+
+	result, err := paymentCollection().InsertOne(ctx, payment)
+	if err != nil {
+		log.Println("Error inserting into payments:", err)
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// ForEnrollment returns the ledger of an enrollment, oldest first
+func (p *Payment) ForEnrollment(enrollmentID string) ([]*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "paid_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := paymentCollection().Find(ctx, bson.M{"enrollment_id": enrollmentID}, opts)
+	if err != nil {
+		log.Println("Finding payments error:", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	payments := []*Payment{}
+
+	for cursor.Next(ctx) {
+		var item Payment
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding payment into slice:", err)
+			return nil, err
+		}
+		payments = append(payments, &item)
+	}
+
+	return payments, nil
+}
+
+// SetPaymentSummary keeps the has_paid, paid_date and paid_amount fields of an
+// enrollment in line with its ledger, for clients that only read those
+func (e *Enrollment) SetPaymentSummary(id string, balance Balance, lastPaid time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	hasPaid := "no"
+	if balance.Settled() {
+		hasPaid = "yes"
+	}
+
+	paidDate := ""
+	if !lastPaid.IsZero() {
+		paidDate = lastPaid.Format("2006-01-02")
+	}
+
+	_, err = enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "has_paid", Value: hasPaid},
+				{Key: "paid_date", Value: paidDate},
+				{Key: "paid_amount", Value: strconv.FormatInt(balance.NetPaid(), 10)},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+
+	return err
+}
+
+// AddNetPaid moves the net amount paid for an enrollment by delta, up for a payment and
+// down for a refund. A refund that would take it below zero changes nothing and returns
+// ErrRefundTooLarge, so concurrent refunds can't give back more than was paid together.
+func (e *Enrollment) AddNetPaid(id string, delta int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := enrollmentCollection().UpdateOne(
+		ctx,
+		netPaidFilter(docID, delta),
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "net_paid", Value: delta}}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := e.GetOne(id); err != nil {
+			return err
+		}
+		return ErrRefundTooLarge
+	}
+
+	return nil
+}
+
+// netPaidFilter matches the enrollment docID when its net amount paid can move by delta,
+// which it can't go below zero
+func netPaidFilter(docID primitive.ObjectID, delta int64) bson.M {
+	filter := bson.M{"_id": docID}
+	if delta < 0 {
+		filter["net_paid"] = bson.M{"$gte": -delta}
+	}
+
+	return filter
+}
+
+// CountNetPaid sets the net amount paid of the enrollments stored before it was kept on
+// them, from their ledger. It is run once at startup.
+func (e *Enrollment) CountNetPaid() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cursor, err := enrollmentCollection().Find(ctx, bson.M{"net_paid": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry Enrollment
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+
+		payments, err := (&Payment{}).ForEnrollment(entry.ID)
+		if err != nil {
+			return err
+		}
+		balance := ComputeBalance(entry.Fee, entry.Currency, payments)
+
+		docID, _ := primitive.ObjectIDFromHex(entry.ID)
+		_, err = enrollmentCollection().UpdateOne(ctx,
+			bson.M{"_id": docID, "net_paid": bson.M{"$exists": false}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "net_paid", Value: balance.NetPaid()}}}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
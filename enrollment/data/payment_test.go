@@ -0,0 +1,113 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestComputeBalance(t *testing.T) {
+	payment := func(amount int64) *Payment { return &Payment{Kind: PaymentKindPayment, Amount: amount} }
+	refund := func(amount int64) *Payment { return &Payment{Kind: PaymentKindRefund, Amount: amount} }
+
+	tests := []struct {
+		name        string
+		fee         int64
+		payments    []*Payment
+		want        Balance
+		wantNetPaid int64
+		wantSettled bool
+	}{
+		{
+			name: "nothing paid",
+			fee:  1000,
+			want: Balance{Currency: "VND", Fee: 1000, Outstanding: 1000},
+		},
+		{
+			name:        "paid in part",
+			fee:         1000,
+			payments:    []*Payment{payment(300), payment(200)},
+			want:        Balance{Currency: "VND", Fee: 1000, Paid: 500, Outstanding: 500},
+			wantNetPaid: 500,
+		},
+		{
+			name:        "paid in full",
+			fee:         1000,
+			payments:    []*Payment{payment(600), payment(400)},
+			want:        Balance{Currency: "VND", Fee: 1000, Paid: 1000},
+			wantNetPaid: 1000,
+			wantSettled: true,
+		},
+		{
+			name:        "paid too much",
+			fee:         1000,
+			payments:    []*Payment{payment(1200)},
+			want:        Balance{Currency: "VND", Fee: 1000, Paid: 1200, Outstanding: -200},
+			wantNetPaid: 1200,
+			wantSettled: true,
+		},
+		{
+			name:        "refunded in part",
+			fee:         1000,
+			payments:    []*Payment{payment(1000), refund(250)},
+			want:        Balance{Currency: "VND", Fee: 1000, Paid: 1000, Refunded: 250, Outstanding: 250},
+			wantNetPaid: 750,
+		},
+		{
+			name:     "refunded in full",
+			fee:      1000,
+			payments: []*Payment{payment(1000), refund(1000)},
+			want:     Balance{Currency: "VND", Fee: 1000, Paid: 1000, Refunded: 1000, Outstanding: 1000},
+		},
+		{
+			name:     "free enrollment",
+			payments: nil,
+			want:     Balance{Currency: "VND"},
+		},
+		{
+			name:        "unknown kind",
+			fee:         1000,
+			payments:    []*Payment{payment(400), {Kind: "voucher", Amount: 600}},
+			want:        Balance{Currency: "VND", Fee: 1000, Paid: 400, Outstanding: 600},
+			wantNetPaid: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeBalance(tt.fee, "VND", tt.payments)
+			if got != tt.want {
+				t.Errorf("ComputeBalance = %+v, want %+v", got, tt.want)
+			}
+			if got.NetPaid() != tt.wantNetPaid {
+				t.Errorf("NetPaid = %d, want %d", got.NetPaid(), tt.wantNetPaid)
+			}
+			if got.Settled() != tt.wantSettled {
+				t.Errorf("Settled = %v, want %v", got.Settled(), tt.wantSettled)
+			}
+		})
+	}
+}
+
+func TestNetPaidFilter(t *testing.T) {
+	docID := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		delta int64
+		want  bson.M
+	}{
+		{"payment", 500, bson.M{"_id": docID}},
+		{"refund", -500, bson.M{"_id": docID, "net_paid": bson.M{"$gte": int64(500)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := netPaidFilter(docID, tt.delta); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("netPaidFilter(%d) = %v, want %v", tt.delta, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the status an enrollment can be in
+const (
+	StatusEnrolled   = "enrolled"
+	StatusCompleted  = "completed"
+	StatusPostponed  = "postponed"
+	StatusUnenrolled = "unenrolled"
+)
+
+var (
+	// ErrInvalidTransition is returned when the status graph doesn't allow the change
+	ErrInvalidTransition = errors.New("status transition not allowed")
+	// ErrStatusConflict is returned when the status changed while a transition was applied
+	ErrStatusConflict = errors.New("status was changed by another request")
+)
+
+// statusTransitions lists, for every status, the statuses it may move to.
+// A completed enrollment is final.
+var statusTransitions = map[string][]string{
+	StatusEnrolled:   {StatusCompleted, StatusPostponed, StatusUnenrolled},
+	StatusPostponed:  {StatusEnrolled, StatusUnenrolled},
+	StatusUnenrolled: {StatusEnrolled},
+	StatusCompleted:  {},
+}
+
+// StatusChange is one entry of an enrollment's status history
+type StatusChange struct {
+	From   string    `bson:"from" json:"from"`
+	To     string    `bson:"to" json:"to"`
+	Actor  string    `bson:"actor" json:"actor"`
+	Reason string    `bson:"reason" json:"reason"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// ValidStatus reports whether status is one of the known enrollment statuses
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an enrollment may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves entry to a new status, with the classes it has a seat in and the ones it
+// waits for in that status, and appends the change to its history, all in one update. The
+// update only applies if the stored status is still the one of entry, so two concurrent
+// transitions can't both succeed.
+func (e *Enrollment) Transition(entry *Enrollment, to, actor, reason string, class, waitlist []string) (*Enrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if !CanTransition(entry.Status, to) {
+		return nil, ErrInvalidTransition
+	}
+
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	change := StatusChange{
+		From:   entry.Status,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		At:     time.Now(),
+	}
+
+	result, err := enrollmentCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "status": entry.Status},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: to},
+				{Key: "class", Value: class},
+				{Key: "waitlist", Value: waitlist},
+				{Key: "updated_by", Value: actor},
+				{Key: "updated_at", Value: change.At},
+			}},
+			{Key: "$push", Value: bson.D{
+				{Key: "history", Value: change},
+			}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, ErrStatusConflict
+	}
+
+	updated := *entry
+	updated.Status = to
+	updated.Class = class
+	updated.Waitlist = waitlist
+	updated.UpdatedBy = actor
+	updated.UpdatedAt = change.At
+	updated.History = append(append([]StatusChange{}, entry.History...), change)
+
+	return &updated, nil
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusEnrolled, StatusCompleted, true},
+		{StatusEnrolled, StatusPostponed, true},
+		{StatusEnrolled, StatusUnenrolled, true},
+		{StatusPostponed, StatusEnrolled, true},
+		{StatusPostponed, StatusUnenrolled, true},
+		{StatusUnenrolled, StatusEnrolled, true},
+
+		{StatusEnrolled, StatusEnrolled, false},
+		{StatusPostponed, StatusCompleted, false},
+		{StatusUnenrolled, StatusPostponed, false},
+		{StatusUnenrolled, StatusCompleted, false},
+		{StatusCompleted, StatusEnrolled, false},
+		{StatusCompleted, StatusUnenrolled, false},
+		{"", StatusEnrolled, false},
+		{StatusEnrolled, "graduated", false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStatusTransitions(t *testing.T) {
+	// every status can be reached and left only for known statuses
+	reached := map[string]bool{StatusEnrolled: true}
+	for from, next := range statusTransitions {
+		for _, to := range next {
+			if !ValidStatus(to) {
+				t.Errorf("%s moves to unknown status %q", from, to)
+			}
+			reached[to] = true
+		}
+	}
+
+	for status := range statusTransitions {
+		if !reached[status] {
+			t.Errorf("no enrollment can get to %s", status)
+		}
+	}
+
+	if len(statusTransitions[StatusCompleted]) != 0 {
+		t.Errorf("a completed enrollment moves on to %v, it should be final", statusTransitions[StatusCompleted])
+	}
+}
+
+func TestTransition_NotAllowed(t *testing.T) {
+	var e Enrollment
+
+	// refused before the database is touched
+	_, err := e.Transition(&Enrollment{ID: "64b7f0c2a1b2c3d4e5f60718", Status: StatusCompleted}, StatusEnrolled,
+		"admin@example.com", "", nil, nil)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Transition returned %v, want %v", err, ErrInvalidTransition)
+	}
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Student is one child in the students collection. The same shape is embedded
+// into enrollments, without the id and the links.
+type Student struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	FullName    string    `bson:"full_name" json:"full_name"`
+	NickName    string    `bson:"nick_name" json:"nick_name"`
+	DOB         string    `bson:"dob" json:"dob"`
+	Age         int       `bson:"age" json:"age"`
+	Gender      string    `bson:"gender" json:"gender"`
+	GuardianIDs []string  `bson:"guardian_ids,omitempty" json:"guardian_ids,omitempty"`
+	CreatedAt   time.Time `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// Snapshot returns the student without id, links and timestamps, as stored in an enrollment
+func (s *Student) Snapshot() Student {
+	return Student{
+		FullName: s.FullName,
+		NickName: s.NickName,
+		DOB:      s.DOB,
+		Age:      s.Age,
+		Gender:   s.Gender,
+	}
+}
+
+func studentCollection() *mongo.Collection {
+	return client.Database("enrollment").Collection("students")
+}
+
+// studentNameCollation compares the names of students without regard to case
+var studentNameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// EnsureIndexes makes the name and date of birth of a student unique, the name compared
+// without regard to case. Students without a date of birth aren't covered, two children
+// may share a name. It fails while the collection holds duplicates.
+func (s *Student) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := studentCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "full_name", Value: 1}, {Key: "dob", Value: 1}},
+		Options: options.Index().
+			SetName("unique_name_dob").
+			SetUnique(true).
+			SetCollation(studentNameCollation).
+			SetPartialFilterExpression(bson.M{"dob": bson.M{"$gt": ""}}),
+	})
+
+	return err
+}
+
+// Insert stores a new student and returns its id
+func (s *Student) Insert(student Student) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	student.ID = ""
+	student.FullName = strings.TrimSpace(student.FullName)
+	student.CreatedAt = time.Now()
+	student.UpdatedAt = time.Now()
+
+	result, err := studentCollection().InsertOne(ctx, student)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", ErrDuplicate
+	}
+	if err != nil {
+		log.Println("Error inserting into students:", err)
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// FindDuplicate returns the student with the same name and date of birth,
+// or ErrNotFound. The name is compared case-insensitively. A student without a
+// date of birth has no duplicate, two children may share a name.
+func (s *Student) FindDuplicate(student Student) (*Student, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if strings.TrimSpace(student.DOB) == "" {
+		return nil, ErrNotFound
+	}
+
+	filter := bson.M{
+		"full_name": strings.TrimSpace(student.FullName),
+		"dob":       student.DOB,
+	}
+
+	var existing Student
+	err := studentCollection().FindOne(ctx, filter, options.FindOne().SetCollation(studentNameCollation)).Decode(&existing)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &existing, nil
+}
+
+// All returns every student sorted by name
+func (s *Student) All() ([]*Student, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "full_name", Value: 1}})
+
+	cursor, err := studentCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		log.Println("Finding all students error:", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	students := []*Student{}
+
+	for cursor.Next(ctx) {
+		var item Student
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding student into slice:", err)
+			return nil, err
+		}
+		students = append(students, &item)
+	}
+
+	return students, nil
+}
+
+// GetOne returns one student by id
+func (s *Student) GetOne(id string) (*Student, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var student Student
+	err = studentCollection().FindOne(ctx, bson.M{"_id": docID}).Decode(&student)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &student, nil
+}
+
+// Update saves the receiver over the stored student with the same id, links are kept
+func (s *Student) Update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(s.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := studentCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": docID},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "full_name", Value: strings.TrimSpace(s.FullName)},
+				{Key: "nick_name", Value: s.NickName},
+				{Key: "dob", Value: s.DOB},
+				{Key: "age", Value: s.Age},
+				{Key: "gender", Value: s.Gender},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WaitlistEntry is one enrollment waiting for a seat in a full class.
+// Entries are served first come, first served.
+type WaitlistEntry struct {
+	ID           string    `bson:"_id,omitempty" json:"id,omitempty"`
+	ClassID      string    `bson:"class_id" json:"class_id"`
+	EnrollmentID string    `bson:"enrollment_id" json:"enrollment_id"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+}
+
+func waitlistCollection() *mongo.Collection {
+	return client.Database("enrollment").Collection("waitlist")
+}
+
+// Insert puts an enrollment at the end of the waitlist of a class
+func (w *WaitlistEntry) Insert(classID, enrollmentID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := waitlistCollection().InsertOne(ctx, WaitlistEntry{
+		ClassID:      classID,
+		EnrollmentID: enrollmentID,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		log.Println("Error inserting into waitlist:", err)
+		return err
+	}
+
+	return nil
+}
+
+// Restore puts back an entry taken off the waitlist by PopNext, at the place in line it had
+func (w *WaitlistEntry) Restore(entry *WaitlistEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := waitlistCollection().InsertOne(ctx, WaitlistEntry{
+		ClassID:      entry.ClassID,
+		EnrollmentID: entry.EnrollmentID,
+		CreatedAt:    entry.CreatedAt,
+	})
+	if err != nil {
+		log.Println("Error restoring waitlist entry:", err)
+		return err
+	}
+
+	return nil
+}
+
+// ForClass returns the waitlist of a class, first in line first
+func (w *WaitlistEntry) ForClass(classID string) ([]*WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := waitlistCollection().Find(ctx, bson.M{"class_id": classID}, opts)
+	if err != nil {
+		log.Println("Finding waitlist error:", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*WaitlistEntry{}
+
+	for cursor.Next(ctx) {
+		var item WaitlistEntry
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding waitlist entry into slice:", err)
+			return nil, err
+		}
+		entries = append(entries, &item)
+	}
+
+	return entries, nil
+}
+
+// PopNext removes and returns the first entry on the waitlist of a class.
+// It returns ErrNotFound when nobody is waiting.
+func (w *WaitlistEntry) PopNext(classID string) (*WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndDelete()
+	opts.SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	var entry WaitlistEntry
+	err := waitlistCollection().FindOneAndDelete(ctx, bson.M{"class_id": classID}, opts).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Remove takes an enrollment off the waitlist of one class
+func (w *WaitlistEntry) Remove(classID, enrollmentID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := waitlistCollection().DeleteMany(ctx, bson.M{"class_id": classID, "enrollment_id": enrollmentID})
+
+	return err
+}
+
+// RemoveEnrollment takes an enrollment off every waitlist it is on
+func (w *WaitlistEntry) RemoveEnrollment(enrollmentID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := waitlistCollection().DeleteMany(ctx, bson.M{"enrollment_id": enrollmentID})
+
+	return err
+}
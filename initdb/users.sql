@@ -29,10 +29,13 @@ CREATE TABLE public.users (
     password character varying(60),
     avatar bytea NULL,
     user_active integer DEFAULT 0,
+    role character varying(32) DEFAULT 'read-only' NOT NULL,
     last_login timestamp without time zone NULL,
     password_changed_at timestamp without time zone NULL,
     created_at timestamp without time zone,
-    updated_at timestamp without time zone
+    updated_at timestamp without time zone,
+    deactivated_at timestamp without time zone NULL,
+    deleted_at timestamp without time zone NULL
 );
 
 
@@ -53,6 +56,254 @@ ALTER TABLE ONLY public.users
     ADD CONSTRAINT users_pkey PRIMARY KEY (id);
 
 
-INSERT INTO "public"."users"("email","first_name","last_name","password", "user_active","last_login", "password_changed_at","created_at","updated_at")
+--
+-- Name: sessions; Type: TABLE; Schema: public; Owner: postgres
+--
+CREATE TABLE public.sessions (
+    id character varying(36) NOT NULL,
+    token character varying(64) NOT NULL,
+    username character varying(255) NOT NULL,
+    expiry timestamp without time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    last_seen_at timestamp without time zone NOT NULL,
+    ip character varying(64) DEFAULT '' NOT NULL,
+    user_agent text DEFAULT '' NOT NULL
+);
+
+
+ALTER TABLE public.sessions OWNER TO postgres;
+
+ALTER TABLE ONLY public.sessions
+    ADD CONSTRAINT sessions_pkey PRIMARY KEY (token);
+
+CREATE INDEX sessions_expiry_idx ON public.sessions USING btree (expiry);
+
+CREATE INDEX sessions_username_idx ON public.sessions USING btree (username);
+
+CREATE UNIQUE INDEX sessions_id_idx ON public.sessions USING btree (id);
+
+--
+-- Name: api_keys; Type: TABLE; Schema: public; Owner: postgres
+-- Only the SHA-256 of a key is stored, scopes is a comma separated list of services
+--
+CREATE TABLE public.api_keys (
+    id serial NOT NULL,
+    name character varying(255) NOT NULL,
+    prefix character varying(16) NOT NULL,
+    key_hash character varying(64) NOT NULL,
+    scopes character varying(255) NOT NULL,
+    expires_at timestamp without time zone NULL,
+    last_used_at timestamp without time zone NULL,
+    revoked_at timestamp without time zone NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.api_keys OWNER TO postgres;
+
+ALTER TABLE ONLY public.api_keys
+    ADD CONSTRAINT api_keys_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX api_keys_key_hash_idx ON public.api_keys USING btree (key_hash);
+
+--
+-- Name: password_resets; Type: TABLE; Schema: public; Owner: postgres
+-- Single-use reset tokens, only their SHA-256 is stored
+--
+CREATE TABLE public.password_resets (
+    token_hash character varying(64) NOT NULL,
+    user_id integer NOT NULL,
+    expires_at timestamp without time zone NOT NULL,
+    used_at timestamp without time zone NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.password_resets OWNER TO postgres;
+
+ALTER TABLE ONLY public.password_resets
+    ADD CONSTRAINT password_resets_pkey PRIMARY KEY (token_hash);
+
+CREATE INDEX password_resets_user_id_idx ON public.password_resets USING btree (user_id);
+
+--
+-- Name: invitations; Type: TABLE; Schema: public; Owner: postgres
+--
+CREATE TABLE public.invitations (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    expires_at timestamp without time zone NOT NULL,
+    accepted_at timestamp without time zone NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.invitations OWNER TO postgres;
+
+ALTER TABLE ONLY public.invitations
+    ADD CONSTRAINT invitations_pkey PRIMARY KEY (id);
+
+CREATE INDEX invitations_user_id_idx ON public.invitations USING btree (user_id);
+
+--
+-- Name: login_failures; Type: TABLE; Schema: public; Owner: postgres
+-- Failed sign-ins per email, emails without an account included
+--
+CREATE TABLE public.login_failures (
+    email character varying(255) NOT NULL,
+    failures integer DEFAULT 0 NOT NULL,
+    last_failure_at timestamp without time zone NOT NULL,
+    locked_until timestamp without time zone NULL
+);
+
+
+ALTER TABLE public.login_failures OWNER TO postgres;
+
+ALTER TABLE ONLY public.login_failures
+    ADD CONSTRAINT login_failures_pkey PRIMARY KEY (email);
+
+--
+-- Name: ip_login_failures; Type: TABLE; Schema: public; Owner: postgres
+-- Failed sign-ins per client IP, shared by every replica of the authentication service
+--
+CREATE TABLE public.ip_login_failures (
+    ip character varying(45) NOT NULL,
+    failures integer DEFAULT 0 NOT NULL,
+    last_failure_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.ip_login_failures OWNER TO postgres;
+
+ALTER TABLE ONLY public.ip_login_failures
+    ADD CONSTRAINT ip_login_failures_pkey PRIMARY KEY (ip);
+
+--
+-- Name: user_totp; Type: TABLE; Schema: public; Owner: postgres
+-- The second factor of a user, it counts once confirmed_at is set
+--
+CREATE TABLE public.user_totp (
+    user_id integer NOT NULL,
+    secret character varying(64) NOT NULL,
+    last_step bigint DEFAULT 0 NOT NULL,
+    confirmed_at timestamp without time zone NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.user_totp OWNER TO postgres;
+
+ALTER TABLE ONLY public.user_totp
+    ADD CONSTRAINT user_totp_pkey PRIMARY KEY (user_id);
+
+--
+-- Name: recovery_codes; Type: TABLE; Schema: public; Owner: postgres
+-- Single-use codes for when the authenticator app is lost, only their SHA-256 is stored
+--
+CREATE TABLE public.recovery_codes (
+    user_id integer NOT NULL,
+    code_hash character varying(64) NOT NULL,
+    used_at timestamp without time zone NULL
+);
+
+
+ALTER TABLE public.recovery_codes OWNER TO postgres;
+
+CREATE INDEX recovery_codes_user_id_idx ON public.recovery_codes USING btree (user_id);
+
+--
+-- Name: totp_required_roles; Type: TABLE; Schema: public; Owner: postgres
+-- The roles whose users must set up a second factor
+--
+CREATE TABLE public.totp_required_roles (
+    role character varying(32) NOT NULL
+);
+
+
+ALTER TABLE public.totp_required_roles OWNER TO postgres;
+
+ALTER TABLE ONLY public.totp_required_roles
+    ADD CONSTRAINT totp_required_roles_pkey PRIMARY KEY (role);
+
+--
+-- Name: password_history; Type: TABLE; Schema: public; Owner: postgres
+-- The bcrypt hashes of the passwords users had before, so they can't be used again
+--
+CREATE TABLE public.password_history (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    password_hash character varying(60) NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.password_history OWNER TO postgres;
+
+ALTER TABLE ONLY public.password_history
+    ADD CONSTRAINT password_history_pkey PRIMARY KEY (id);
+
+CREATE INDEX password_history_user_id_idx ON public.password_history USING btree (user_id);
+
+
+--
+-- Name: mail_jobs; Type: TABLE; Schema: public; Owner: postgres
+-- The queue of the mail service, dead jobs are the ones that failed too often
+--
+CREATE TABLE public.mail_jobs (
+    id bigserial NOT NULL,
+    sender character varying(255) NOT NULL,
+    recipient character varying(255) NOT NULL,
+    subject character varying(255) NOT NULL,
+    message text NOT NULL,
+    status character varying(16) NOT NULL,
+    attempts integer NOT NULL,
+    max_attempts integer NOT NULL,
+    next_attempt_at timestamp without time zone NOT NULL,
+    last_error text NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    sent_at timestamp without time zone
+);
+
+
+ALTER TABLE public.mail_jobs OWNER TO postgres;
+
+ALTER TABLE ONLY public.mail_jobs
+    ADD CONSTRAINT mail_jobs_pkey PRIMARY KEY (id);
+
+CREATE INDEX mail_jobs_due_idx ON public.mail_jobs USING btree (status, next_attempt_at);
+
+--
+-- Name: outbox; Type: TABLE; Schema: public; Owner: postgres
+-- The messages of the authentication service for the rest of the stack, written with the change
+-- they are about and delivered by its relay, or dead once they failed too often. The payload
+-- is cleared once delivered, mail can hold links with live tokens.
+--
+CREATE TABLE public.outbox (
+    id bigserial NOT NULL,
+    topic character varying(64) NOT NULL,
+    payload jsonb,
+    attempts integer NOT NULL,
+    next_attempt_at timestamp without time zone NOT NULL,
+    last_error text NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    delivered_at timestamp without time zone,
+    dead_at timestamp without time zone
+);
+
+
+ALTER TABLE public.outbox OWNER TO postgres;
+
+ALTER TABLE ONLY public.outbox
+    ADD CONSTRAINT outbox_pkey PRIMARY KEY (id);
+
+CREATE INDEX outbox_pending_idx ON public.outbox USING btree (next_attempt_at) WHERE delivered_at IS NULL AND dead_at IS NULL;
+
+INSERT INTO "public"."users"("email","first_name","last_name","password", "user_active","role","last_login", "password_changed_at","created_at","updated_at")
+VALUES
+(E'admin@example.com',E'Admin',E'User',E'$2a$12$1zGLuYDDNvATh4RA4avbKuheAMpb1svexSzrQm7up.bnpwQHs0jNe', 1, E'admin', E'0001-01-01 00:00:00', E'0001-01-01 00:00:00',E'2022-03-14 00:00:00',E'2022-03-14 00:00:00');
+
+-- the key clients shared before keys were issued per client, revoke it once they have their own
+INSERT INTO "public"."api_keys"("name","prefix","key_hash","scopes","created_at")
 VALUES
-(E'admin@example.com',E'Admin',E'User',E'$2a$12$1zGLuYDDNvATh4RA4avbKuheAMpb1svexSzrQm7up.bnpwQHs0jNe', 1, E'0001-01-01 00:00:00', E'0001-01-01 00:00:00',E'2022-03-14 00:00:00',E'2022-03-14 00:00:00');
\ No newline at end of file
+(E'legacy shared key',E'sWOmNsF8',E'4f67ba8129f1999e04c10e956e4a3e9ca7d392ee76ac3740a5b966a5ee5ccd62',E'authentication,enrollment',E'2022-03-14 00:00:00');
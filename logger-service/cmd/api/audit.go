@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/logger-service/data"
+)
+
+// WriteAudit stores one entry of the audit trail
+func (app *Config) WriteAudit(ctx *gin.Context) {
+	var requestPayload data.AuditEntry
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := requestPayload.Normalize(time.Now()); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := app.Models.AuditEntry.Insert(requestPayload); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "recorded",
+	})
+}
+
+// SearchAudit returns one page of the audit trail, the latest entries first. It is filtered by
+// the service, action, actor, target, from and to query parameters, the times in RFC 3339, and
+// paged by page and page_size.
+func (app *Config) SearchAudit(ctx *gin.Context) {
+	filter := data.AuditFilter{
+		Service: ctx.Query("service"),
+		Action:  ctx.Query("action"),
+		Actor:   ctx.Query("actor"),
+		Target:  ctx.Query("target"),
+	}
+
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := ctx.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":   "true",
+					"message": name + " must be a time like 2006-01-02T15:04:05Z",
+				})
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	page, pageSize := pagination(ctx)
+
+	entries, total, err := app.Models.AuditEntry.Search(filter, page, pageSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"entries":   entries,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/welab2022/LCS2-Micro/logger-service/data"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+
+	// how many entries one request to /logs may carry
+	maxBatchSize = 1000
+)
+
+func (app *Config) HeartBeat(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "200",
+		"title":   "Health OK",
+		"updated": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// WriteLog stores one log entry
+func (app *Config) WriteLog(ctx *gin.Context) {
+	var requestPayload data.LogEntry
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := requestPayload.Normalize(time.Now()); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := app.Models.LogEntry.Insert(requestPayload); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "logged",
+	})
+}
+
+// WriteLogs stores a batch of log entries, none of them when one is invalid
+func (app *Config) WriteLogs(ctx *gin.Context) {
+	var requestPayload []data.LogEntry
+
+	if err := ctx.ShouldBindJSON(&requestPayload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "true",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if len(requestPayload) > maxBatchSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "true",
+			"message": fmt.Sprintf("at most %d entries can be sent at once", maxBatchSize),
+		})
+		return
+	}
+
+	now := time.Now()
+	for i := range requestPayload {
+		if err := requestPayload[i].Normalize(now); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": fmt.Sprintf("entry %d: %s", i, err),
+			})
+			return
+		}
+	}
+
+	if err := app.Models.LogEntry.Insert(requestPayload...); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("%d entries logged", len(requestPayload)),
+	})
+}
+
+// SearchLogs returns one page of the log entries, the latest first. They are filtered by the
+// service, level, min_level, from, to and q query parameters, the times in RFC 3339 and q
+// words of the message, and paged by page and page_size.
+func (app *Config) SearchLogs(ctx *gin.Context) {
+	filter := data.LogFilter{
+		Service:  ctx.Query("service"),
+		Level:    ctx.Query("level"),
+		MinLevel: ctx.Query("min_level"),
+		Text:     ctx.Query("q"),
+	}
+
+	for name, level := range map[string]string{"level": filter.Level, "min_level": filter.MinLevel} {
+		if level != "" && !data.ValidLevel(level) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":   "true",
+				"message": fmt.Sprintf("%s %q is unknown", name, level),
+			})
+			return
+		}
+	}
+
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := ctx.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":   "true",
+					"message": name + " must be a time like 2006-01-02T15:04:05Z",
+				})
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	page, pageSize := pagination(ctx)
+
+	entries, total, err := app.Models.LogEntry.Search(filter, page, pageSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error, db access failed!"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"entries":   entries,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// pagination reads the page and page_size query parameters
+func pagination(ctx *gin.Context) (page, pageSize int) {
+	page, err := strconv.Atoi(ctx.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err = strconv.Atoi(ctx.Query("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return page, pageSize
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/logger-service/data"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var client *mongo.Client
+
+type Config struct {
+	Models data.Models
+}
+
+func main() {
+	// connect to mongo
+	mongoClient, err := connectToMongo()
+	if err != nil {
+		log.Panic(err)
+	}
+	client = mongoClient
+
+	// create a context in order to disconnect
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// close connection
+	defer func() {
+		if err = client.Disconnect(ctx); err != nil {
+			panic(err)
+		}
+	}()
+
+	app := Config{
+		Models: data.New(client),
+	}
+
+	retention := logRetention()
+	if err := app.Models.LogEntry.EnsureIndexes(retention); err != nil {
+		log.Panic(err)
+	}
+	log.Println("Keeping log entries for", retention)
+
+	if err := app.Models.AuditEntry.EnsureIndexes(); err != nil {
+		log.Panic(err)
+	}
+
+	go app.rpcListen()
+
+	app.startApp()
+}
+
+// logRetention reads how long log entries are kept from LOG_RETENTION_DAYS, 30 days by default
+func logRetention() time.Duration {
+	days := 30
+
+	if value := os.Getenv("LOG_RETENTION_DAYS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			log.Printf("Ignoring LOG_RETENTION_DAYS=%q, it isn't a number of days", value)
+		} else {
+			days = n
+		}
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func connectToMongo() (*mongo.Client, error) {
+	// create connection options
+	clientOptions := options.Client().ApplyURI(mongoURL)
+	clientOptions.SetAuth(options.Credential{
+		Username: os.Getenv("MONGO_USERNAME"),
+		Password: os.Getenv("MONGO_PASSWORD"),
+	})
+
+	// connect
+	c, err := mongo.Connect(context.TODO(), clientOptions)
+	if err != nil {
+		log.Println("Error connecting:", err)
+		return nil, err
+	}
+
+	log.Println("Connected to mongo!")
+
+	return c, nil
+}
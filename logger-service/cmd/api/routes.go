@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	webPort  = "80"
+	rpcPort  = "5001"
+	mongoURL = "mongodb://mongo:27017"
+)
+
+func init() {
+	if os.Getenv("MONGO_URL") != "" {
+		mongoURL = os.Getenv("MONGO_URL")
+	}
+}
+
+func (app *Config) startApp() {
+
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery())
+
+	router.GET("/heartbeat", app.HeartBeat)
+
+	// the logger is only reachable from inside the stack, it isn't behind the api gateway
+	router.POST("/log", app.WriteLog)
+	router.POST("/logs", app.WriteLogs)
+	router.GET("/logs", app.SearchLogs)
+	router.POST("/audit", app.WriteAudit)
+	router.GET("/audit", app.SearchAudit)
+
+	if os.Getenv("LOGGER_PORT") != "" {
+		webPort = os.Getenv("LOGGER_PORT")
+	}
+
+	log.Println("Starting logger service on port", webPort)
+	router.Run(":" + webPort)
+}
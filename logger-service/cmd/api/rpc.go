@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/logger-service/data"
+)
+
+// RPCServer receives log entries over Go net/rpc, for services that would rather not make an
+// HTTP request per entry
+type RPCServer struct {
+	app *Config
+}
+
+// RPCPayload is one log entry sent over RPC
+type RPCPayload struct {
+	Service string
+	Level   string
+	Message string
+	Data    map[string]interface{}
+	Time    time.Time
+}
+
+// LogInfo stores the entry of payload, its reply is a short confirmation
+func (r *RPCServer) LogInfo(payload RPCPayload, resp *string) error {
+	entry := data.LogEntry{
+		Service: payload.Service,
+		Level:   payload.Level,
+		Message: payload.Message,
+		Data:    payload.Data,
+		Time:    payload.Time,
+	}
+
+	if err := entry.Normalize(time.Now()); err != nil {
+		return err
+	}
+
+	if err := r.app.Models.LogEntry.Insert(entry); err != nil {
+		return err
+	}
+
+	*resp = "logged via RPC: " + entry.Service
+	return nil
+}
+
+// rpcListen serves net/rpc on rpcPort until the process exits
+func (app *Config) rpcListen() {
+	if err := rpc.RegisterName("RPCServer", &RPCServer{app: app}); err != nil {
+		log.Panic(err)
+	}
+
+	listen, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", rpcPort))
+	if err != nil {
+		log.Panic(err)
+	}
+	defer listen.Close()
+
+	log.Println("Starting RPC server on port", rpcPort)
+
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			log.Println("RPC accept error:", err)
+			continue
+		}
+		go rpc.ServeConn(conn)
+	}
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrActionRequired = errors.New("action is required")
+
+// AuditEntry is one change of the audit trail of the stack. Action is what was done, like
+// enrollment.updated, Actor who did it, Target what it changed, like enrollment/<id>, and
+// Before and After the fields that changed. Unlike the log entries they are never removed.
+type AuditEntry struct {
+	ID        string                 `bson:"_id,omitempty" json:"id,omitempty"`
+	Service   string                 `bson:"service" json:"service"`
+	Action    string                 `bson:"action" json:"action"`
+	Actor     string                 `bson:"actor" json:"actor"`
+	Target    string                 `bson:"target" json:"target"`
+	IP        string                 `bson:"ip" json:"ip"`
+	Detail    string                 `bson:"detail,omitempty" json:"detail,omitempty"`
+	Before    map[string]interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After     map[string]interface{} `bson:"after,omitempty" json:"after,omitempty"`
+	Time      time.Time              `bson:"time" json:"time"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// Normalize checks the entry, defaults its time to now and keeps only the fields of Before
+// and After that differ, so senders can send what they had before and after the change.
+// The errors are meant to be returned to the sender.
+func (a *AuditEntry) Normalize(now time.Time) error {
+	a.Service = strings.TrimSpace(a.Service)
+	if a.Service == "" {
+		return ErrServiceRequired
+	}
+
+	a.Action = strings.TrimSpace(a.Action)
+	if a.Action == "" {
+		return ErrActionRequired
+	}
+
+	if a.Time.IsZero() {
+		a.Time = now
+	}
+
+	a.Before, a.After = Diff(a.Before, a.After)
+
+	return nil
+}
+
+// Diff returns the fields of before and after whose values differ. Either may be nil,
+// for something that was created or removed.
+func Diff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for key, value := range before {
+		if other, exists := after[key]; !exists || !reflect.DeepEqual(value, other) {
+			changedBefore[key] = value
+		}
+	}
+	for key, value := range after {
+		if other, exists := before[key]; !exists || !reflect.DeepEqual(value, other) {
+			changedAfter[key] = value
+		}
+	}
+
+	if len(changedBefore) == 0 {
+		changedBefore = nil
+	}
+	if len(changedAfter) == 0 {
+		changedAfter = nil
+	}
+
+	return changedBefore, changedAfter
+}
+
+func auditCollection() *mongo.Collection {
+	return client.Database("logs").Collection("audit")
+}
+
+// EnsureIndexes creates the indexes searches of the audit trail use
+func (a *AuditEntry) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err := auditCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "time", Value: -1}}},
+	})
+
+	return err
+}
+
+// Insert stores entries, which must have been normalized
+func (a *AuditEntry) Insert(entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		entry.ID = ""
+		entry.CreatedAt = now
+		docs[i] = entry
+	}
+
+	_, err := auditCollection().InsertMany(ctx, docs)
+	if err != nil {
+		log.Println("Error inserting into the audit trail:", err)
+		return err
+	}
+
+	return nil
+}
+
+// AuditFilter selects audit entries, empty fields match every entry
+type AuditFilter struct {
+	Service string
+	Action  string
+	Actor   string
+	Target  string
+	From    time.Time
+	To      time.Time
+}
+
+func (f AuditFilter) query() bson.M {
+	query := bson.M{}
+
+	for field, value := range map[string]string{
+		"service": f.Service,
+		"action":  f.Action,
+		"actor":   f.Actor,
+		"target":  f.Target,
+	} {
+		if value != "" {
+			query[field] = value
+		}
+	}
+
+	at := bson.M{}
+	if !f.From.IsZero() {
+		at["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		at["$lt"] = f.To
+	}
+	if len(at) > 0 {
+		query["time"] = at
+	}
+
+	return query
+}
+
+// Search returns one page of the audit entries matching filter, the latest first, and how many
+// match in total. page starts at 1.
+func (a *AuditEntry) Search(filter AuditFilter, page, pageSize int) ([]*AuditEntry, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	query := filter.query()
+
+	total, err := auditCollection().CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}})
+	opts.SetSkip(int64((page - 1) * pageSize))
+	opts.SetLimit(int64(pageSize))
+
+	cursor, err := auditCollection().Find(ctx, query, opts)
+	if err != nil {
+		log.Println("Finding audit entries error:", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*AuditEntry{}
+
+	for cursor.Next(ctx) {
+		var item AuditEntry
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding audit entry into slice:", err)
+			return nil, 0, err
+		}
+		entries = append(entries, &item)
+	}
+
+	return entries, total, cursor.Err()
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     map[string]interface{}
+		after      map[string]interface{}
+		wantBefore map[string]interface{}
+		wantAfter  map[string]interface{}
+	}{
+		{
+			name:       "changed fields",
+			before:     map[string]interface{}{"status": "pending", "fee": 100.0, "name": "Ann"},
+			after:      map[string]interface{}{"status": "enrolled", "fee": 100.0, "name": "Ann"},
+			wantBefore: map[string]interface{}{"status": "pending"},
+			wantAfter:  map[string]interface{}{"status": "enrolled"},
+		},
+		{
+			name:      "created",
+			after:     map[string]interface{}{"role": "admin"},
+			wantAfter: map[string]interface{}{"role": "admin"},
+		},
+		{
+			name:       "removed",
+			before:     map[string]interface{}{"role": "admin"},
+			wantBefore: map[string]interface{}{"role": "admin"},
+		},
+		{
+			name:       "field dropped",
+			before:     map[string]interface{}{"phone": "555", "email": "a@example.com"},
+			after:      map[string]interface{}{"email": "a@example.com"},
+			wantBefore: map[string]interface{}{"phone": "555"},
+		},
+		{
+			name:       "nested values",
+			before:     map[string]interface{}{"classes": []interface{}{"a"}},
+			after:      map[string]interface{}{"classes": []interface{}{"a", "b"}},
+			wantBefore: map[string]interface{}{"classes": []interface{}{"a"}},
+			wantAfter:  map[string]interface{}{"classes": []interface{}{"a", "b"}},
+		},
+		{
+			name:   "nothing changed",
+			before: map[string]interface{}{"n": 1.0},
+			after:  map[string]interface{}{"n": 1.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBefore, gotAfter := Diff(tt.before, tt.after)
+			if !reflect.DeepEqual(gotBefore, tt.wantBefore) || !reflect.DeepEqual(gotAfter, tt.wantAfter) {
+				t.Errorf("Diff = %v, %v, want %v, %v", gotBefore, gotAfter, tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestAuditEntry_Normalize(t *testing.T) {
+	now := time.Now()
+
+	entry := AuditEntry{
+		Service: " enrollment ",
+		Action:  "enrollment.updated",
+		Before:  map[string]interface{}{"fee": 100.0, "note": "x"},
+		After:   map[string]interface{}{"fee": 120.0, "note": "x"},
+	}
+	if err := entry.Normalize(now); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Service != "enrollment" || !entry.Time.Equal(now) {
+		t.Errorf("unexpected normalized entry %+v", entry)
+	}
+	if len(entry.Before) != 1 || len(entry.After) != 1 {
+		t.Errorf("expected only the fee to be kept, got %v, %v", entry.Before, entry.After)
+	}
+
+	invalid := []AuditEntry{
+		{Action: "user_added"},
+		{Service: "authentication"},
+	}
+	for _, entry := range invalid {
+		if err := entry.Normalize(now); err == nil {
+			t.Errorf("expected %+v to be rejected", entry)
+		}
+	}
+}
+
+func TestAuditFilter_Query(t *testing.T) {
+	from := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	query := AuditFilter{Service: "authentication", Actor: "admin@example.com", From: from}.query()
+	expected := bson.M{
+		"service": "authentication",
+		"actor":   "admin@example.com",
+		"time":    bson.M{"$gte": from},
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Errorf("expected %v, got %v", expected, query)
+	}
+
+	if query := (AuditFilter{}).query(); len(query) != 0 {
+		t.Errorf("expected an empty filter to match everything, got %v", query)
+	}
+}
@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var client *mongo.Client
+
+// the levels a log entry can have, from the least to the most severe
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levels = map[string]bool{LevelDebug: true, LevelInfo: true, LevelWarn: true, LevelError: true}
+
+// how long one log entry may be, longer messages are cut
+const maxMessageLength = 8192
+
+var (
+	ErrServiceRequired = errors.New("service is required")
+	ErrMessageRequired = errors.New("message is required")
+)
+
+func New(mongo *mongo.Client) Models {
+	client = mongo
+
+	return Models{
+		LogEntry:   LogEntry{},
+		AuditEntry: AuditEntry{},
+	}
+}
+
+type Models struct {
+	LogEntry   LogEntry
+	AuditEntry AuditEntry
+}
+
+// LogEntry is one event sent by a service. Data holds whatever structured fields came with it.
+type LogEntry struct {
+	ID        string                 `bson:"_id,omitempty" json:"id,omitempty"`
+	Service   string                 `bson:"service" json:"service"`
+	Level     string                 `bson:"level" json:"level"`
+	Message   string                 `bson:"message" json:"message"`
+	Data      map[string]interface{} `bson:"data,omitempty" json:"data,omitempty"`
+	Time      time.Time              `bson:"time" json:"time"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// Normalize checks the entry and fills in what a sender may leave out: the level defaults to
+// info and the time to now. The errors are meant to be returned to the sender.
+func (l *LogEntry) Normalize(now time.Time) error {
+	l.Service = strings.TrimSpace(l.Service)
+	if l.Service == "" {
+		return ErrServiceRequired
+	}
+
+	if strings.TrimSpace(l.Message) == "" {
+		return ErrMessageRequired
+	}
+	if len(l.Message) > maxMessageLength {
+		l.Message = l.Message[:maxMessageLength]
+	}
+
+	l.Level = strings.ToLower(strings.TrimSpace(l.Level))
+	if l.Level == "" {
+		l.Level = LevelInfo
+	}
+	if !levels[l.Level] {
+		return fmt.Errorf("level must be one of %s, %s, %s or %s", LevelDebug, LevelInfo, LevelWarn, LevelError)
+	}
+
+	if l.Time.IsZero() {
+		l.Time = now
+	}
+
+	return nil
+}
+
+func collection() *mongo.Collection {
+	return client.Database("logs").Collection("entries")
+}
+
+// EnsureIndexes creates the indexes searches use, and the TTL index that removes entries
+// retention after they were received. An existing TTL index is changed to the new retention.
+func (l *LogEntry) EnsureIndexes(retention time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	seconds := int32(retention / time.Second)
+
+	_, err := collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "service", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "level", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "message", Value: "text"}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("retention").SetExpireAfterSeconds(seconds),
+	})
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Name == "IndexOptionsConflict" {
+		log.Println("Changing the retention of log entries to", retention)
+		return client.Database("logs").RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: "entries"},
+			{Key: "index", Value: bson.D{{Key: "name", Value: "retention"}, {Key: "expireAfterSeconds", Value: seconds}}},
+		}).Err()
+	}
+
+	return err
+}
+
+// Insert stores entries, which must have been normalized
+func (l *LogEntry) Insert(entries ...LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		entry.ID = ""
+		entry.CreatedAt = now
+		docs[i] = entry
+	}
+
+	_, err := collection().InsertMany(ctx, docs)
+	if err != nil {
+		log.Println("Error inserting into logs:", err)
+		return err
+	}
+
+	return nil
+}
+
+// LogFilter selects log entries, empty fields match every entry. Text matches the words
+// of the message, MinLevel entries of that level and the more severe ones.
+type LogFilter struct {
+	Service  string
+	Level    string
+	MinLevel string
+	From     time.Time
+	To       time.Time
+	Text     string
+}
+
+func (f LogFilter) query() bson.M {
+	query := bson.M{}
+
+	if f.Service != "" {
+		query["service"] = f.Service
+	}
+
+	if f.Level != "" {
+		query["level"] = f.Level
+	} else if f.MinLevel != "" {
+		query["level"] = bson.M{"$in": levelsFrom(f.MinLevel)}
+	}
+
+	at := bson.M{}
+	if !f.From.IsZero() {
+		at["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		at["$lt"] = f.To
+	}
+	if len(at) > 0 {
+		query["time"] = at
+	}
+
+	if f.Text != "" {
+		query["$text"] = bson.M{"$search": f.Text}
+	}
+
+	return query
+}
+
+// levelsFrom returns level and the levels more severe than it
+func levelsFrom(level string) []string {
+	ordered := []string{LevelDebug, LevelInfo, LevelWarn, LevelError}
+
+	for i, l := range ordered {
+		if l == level {
+			return ordered[i:]
+		}
+	}
+
+	return []string{level}
+}
+
+// ValidLevel reports whether level is one a log entry can have
+func ValidLevel(level string) bool {
+	return levels[level]
+}
+
+// Search returns one page of the entries matching filter, the latest first, and how many
+// match in total. page starts at 1.
+func (l *LogEntry) Search(filter LogFilter, page, pageSize int) ([]*LogEntry, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	query := filter.query()
+
+	total, err := collection().CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}})
+	opts.SetSkip(int64((page - 1) * pageSize))
+	opts.SetLimit(int64(pageSize))
+
+	cursor, err := collection().Find(ctx, query, opts)
+	if err != nil {
+		log.Println("Finding logs error:", err)
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*LogEntry{}
+
+	for cursor.Next(ctx) {
+		var item LogEntry
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Print("Error decoding log into slice:", err)
+			return nil, 0, err
+		}
+		entries = append(entries, &item)
+	}
+
+	return entries, total, cursor.Err()
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLogEntry_Normalize(t *testing.T) {
+	now := time.Now()
+
+	entry := LogEntry{Service: " enrollment ", Level: "WARN", Message: "slow query"}
+	if err := entry.Normalize(now); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Service != "enrollment" || entry.Level != LevelWarn || !entry.Time.Equal(now) {
+		t.Errorf("unexpected normalized entry %+v", entry)
+	}
+
+	entry = LogEntry{Service: "auth", Message: "signed in"}
+	if err := entry.Normalize(now); err != nil || entry.Level != LevelInfo {
+		t.Errorf("expected the level to default to info, got %q, %v", entry.Level, err)
+	}
+
+	entry = LogEntry{Service: "auth", Message: strings.Repeat("x", maxMessageLength+1)}
+	if err := entry.Normalize(now); err != nil || len(entry.Message) != maxMessageLength {
+		t.Errorf("expected the message to be cut to %d, got %d, %v", maxMessageLength, len(entry.Message), err)
+	}
+
+	invalid := []LogEntry{
+		{Message: "no service"},
+		{Service: "auth"},
+		{Service: "auth", Message: "bad level", Level: "fatal"},
+	}
+	for _, entry := range invalid {
+		if err := entry.Normalize(now); err == nil {
+			t.Errorf("expected %+v to be rejected", entry)
+		}
+	}
+}
+
+func TestLogFilter_Query(t *testing.T) {
+	from := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	query := LogFilter{Service: "auth", MinLevel: LevelWarn, From: from, Text: "timeout"}.query()
+	expected := bson.M{
+		"service": "auth",
+		"level":   bson.M{"$in": []string{LevelWarn, LevelError}},
+		"time":    bson.M{"$gte": from},
+		"$text":   bson.M{"$search": "timeout"},
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Errorf("expected %v, got %v", expected, query)
+	}
+
+	// an exact level wins over the minimum one
+	query = LogFilter{Level: LevelDebug, MinLevel: LevelError}.query()
+	if query["level"] != LevelDebug {
+		t.Errorf("expected level debug, got %v", query["level"])
+	}
+
+	if query := (LogFilter{}).query(); len(query) != 0 {
+		t.Errorf("expected an empty filter to match everything, got %v", query)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// the scope of the keys the services send mail with, and the administrators manage the queue with
+const apiKeyScope = "mail"
+
+// authentication and enrollment send a mail on many of their requests, so a key the
+// authentication service accepted isn't checked again for this long. A revoked key stops
+// sending mail within it.
+const apiKeyCacheTTL = time.Minute
+
+var errAPIKeyRejected = errors.New("api key rejected")
+
+// APIKeys asks the authentication service, which issues the keys, whether a key is one of
+// the mail scope
+type APIKeys struct {
+	url    string
+	client *http.Client
+
+	mu sync.Mutex
+	// when each accepted key has to be checked again, by the hash of the key
+	recheckAt map[[sha256.Size]byte]time.Time
+}
+
+func NewAPIKeys(url string) *APIKeys {
+	return &APIKeys{
+		url:       url,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		recheckAt: make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+// Verify returns nil when key may send mail and manage the queue
+func (k *APIKeys) Verify(key string) error {
+	sum := sha256.Sum256([]byte(key))
+	if k.accepted(sum, time.Now()) {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{"key": key, "scope": apiKeyScope})
+	if err != nil {
+		return err
+	}
+
+	response, err := k.client.Post(k.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		k.accept(sum, time.Now())
+		return nil
+	case http.StatusUnauthorized:
+		return errAPIKeyRejected
+	default:
+		return fmt.Errorf("verifying api key: status %d", response.StatusCode)
+	}
+}
+
+func (k *APIKeys) accepted(sum [sha256.Size]byte, now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return now.Before(k.recheckAt[sum])
+}
+
+// accept remembers the key with the hash sum, and forgets the ones due for a check
+func (k *APIKeys) accept(sum [sha256.Size]byte, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for cached, at := range k.recheckAt {
+		if !now.Before(at) {
+			delete(k.recheckAt, cached)
+		}
+	}
+	k.recheckAt[sum] = now.Add(apiKeyCacheTTL)
+}
+
+// requireAPIKey lets through only the requests with an X-API-KEY of the mail scope: the
+// services sending mail and the administrators of the queue
+func (app *Config) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-KEY")
+		if key == "" {
+			app.errorJSON(w, errors.New("must have X-API-KEY header"), http.StatusUnauthorized)
+			return
+		}
+
+		err := app.APIKeys.Verify(key)
+		if errors.Is(err, errAPIKeyRejected) {
+			app.errorJSON(w, errors.New("key is mismatched"), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("requireAPIKey: %s", err)
+			app.errorJSON(w, errors.New("can't check api key"), http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
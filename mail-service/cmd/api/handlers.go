@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/welab2022/LCS2-Micro/mailer-service/data"
 )
 
 func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
@@ -22,30 +27,112 @@ func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg := Message{
-		From:    requestPayload.From,
-		To:      requestPayload.To,
-		Subject: requestPayload.Subject,
-		Data:    requestPayload.Message,
+	if requestPayload.To == "" {
+		app.errorJSON(w, errors.New("to is required"))
+		return
 	}
 
-	log.Printf("mail: %s", msg)
-
-	err = app.Mailer.SendSMTPMessage(msg)
+	// the message is sent in the background, its status can be followed by id
+	id, err := app.Models.Job.Enqueue(data.Job{
+		From:        requestPayload.From,
+		To:          requestPayload.To,
+		Subject:     requestPayload.Subject,
+		Message:     requestPayload.Message,
+		MaxAttempts: app.Queue.MaxAttempts,
+	})
 	if err != nil {
 		log.Println(err)
-		app.errorJSON(w, err)
+		app.errorJSON(w, errors.New("can't queue the message"), http.StatusInternalServerError)
 		return
 	}
 
+	log.Printf("mail: queued job %d to %s", id, requestPayload.To)
+
 	payload := jsonResponse{
 		Error:   false,
-		Message: "sent to " + requestPayload.To,
+		Message: "queued for " + requestPayload.To,
+		Data: map[string]any{
+			"id":     id,
+			"status": data.JobQueued,
+		},
 	}
 
 	app.writeJSON(w, http.StatusAccepted, payload)
 }
 
+// MailStatus reports where the message with the id of the url is in the queue
+func (app *Config) MailStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid message id"))
+		return
+	}
+
+	job, err := app.Models.Job.GetOne(id)
+	if err != nil {
+		if errors.Is(err, data.ErrJobNotFound) {
+			app.errorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		app.errorJSON(w, errors.New("can't read the queue"), http.StatusInternalServerError)
+		return
+	}
+
+	// the status is for the sender, who knows what they sent
+	job.Message = ""
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: job.Status,
+		Data:    job,
+	})
+}
+
+// DeadLetters lists the messages that failed too often to be sent
+func (app *Config) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	jobs, err := app.Models.Job.Dead()
+	if err != nil {
+		log.Println(err)
+		app.errorJSON(w, errors.New("can't read the queue"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: strconv.Itoa(len(jobs)) + " dead letters",
+		Data:    jobs,
+	})
+}
+
+// RetryMail queues the dead letter with the id of the url again
+func (app *Config) RetryMail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid message id"))
+		return
+	}
+
+	if err := app.Models.Job.Retry(id); err != nil {
+		if errors.Is(err, data.ErrJobNotFound) {
+			app.errorJSON(w, errors.New("no dead letter with that id"), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		app.errorJSON(w, errors.New("can't update the queue"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusAccepted, jsonResponse{
+		Error:   false,
+		Message: "queued again",
+		Data: map[string]any{
+			"id":     id,
+			"status": data.JobQueued,
+		},
+	})
+}
+
 func (app *Config) VerifyMail(w http.ResponseWriter, r *http.Request) {
 	type emailAddress struct {
 		Email string `json:"email"`
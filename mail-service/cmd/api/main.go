@@ -1,23 +1,57 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/welab2022/LCS2-Micro/mailer-service/data"
 )
 
+var counts int64
+
 type Config struct {
-	Mailer Mail
+	Mailer  Mail
+	DB      *sql.DB
+	Models  data.Models
+	Queue   QueueConfig
+	APIKeys *APIKeys
 }
 
 const webPort = "80"
 
+// where the API keys of the queue routes are checked
+var authServiceURL = "http://host.docker.internal:9000"
+
 func main() {
+	// connect to DB, the queue of messages lives there
+	conn := connectToDB()
+	if conn == nil {
+		log.Panic("Can't connect to Postgres!")
+	}
+
+	if os.Getenv("AUTH_SERVICE_URL") != "" {
+		authServiceURL = os.Getenv("AUTH_SERVICE_URL")
+	}
+
 	app := Config{
-		Mailer: createMail(),
+		Mailer:  createMail(),
+		DB:      conn,
+		Models:  data.New(conn),
+		Queue:   newQueueConfig(),
+		APIKeys: NewAPIKeys(authServiceURL + "/apikeys/verify"),
+	}
+
+	// deliver the queued messages in the background
+	for i := 0; i < app.Queue.Workers; i++ {
+		go app.deliverMail()
 	}
+	go app.collectSentJobs(time.Hour)
 
 	log.Println("Starting mail service on port", webPort)
 
@@ -47,3 +81,44 @@ func createMail() Mail {
 
 	return m
 }
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func connectToDB() *sql.DB {
+	dsn := os.Getenv("DSN")
+	if dsn == "" {
+		dsn = "host=localhost port=5432 user=postgres password=password dbname=users sslmode=disable timezone=UTC connect_timeout=5"
+	}
+
+	for {
+		connection, err := openDB(dsn)
+		if err != nil {
+			log.Println("Postgres not yet ready ...")
+			counts++
+		} else {
+			log.Println("Connected to Postgres!")
+			return connection
+		}
+
+		if counts > 10 {
+			log.Println(err)
+			return nil
+		}
+
+		log.Println("Backing off for two seconds....")
+		time.Sleep(2 * time.Second)
+		continue
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/welab2022/LCS2-Micro/mailer-service/data"
+)
+
+const (
+	// how long a worker may take to send one message before another worker can claim it
+	jobLease = 2 * time.Minute
+	// how often an idle worker looks for due messages
+	pollInterval = 2 * time.Second
+	// how long delivered messages are kept, so their status can still be looked up
+	sentRetention = 7 * 24 * time.Hour
+)
+
+// QueueConfig is how the queue delivers messages. A failed message is tried again after
+// RetryBase, twice as long after each further failure up to RetryMax, and is a dead letter
+// once it failed MaxAttempts times.
+type QueueConfig struct {
+	Workers     int
+	MaxAttempts int
+	RetryBase   time.Duration
+	RetryMax    time.Duration
+}
+
+// newQueueConfig reads the queue settings from the environment: MAIL_WORKERS,
+// MAIL_MAX_ATTEMPTS, MAIL_RETRY_BASE_SECONDS and MAIL_RETRY_MAX_SECONDS
+func newQueueConfig() QueueConfig {
+	return QueueConfig{
+		Workers:     envInt("MAIL_WORKERS", 2),
+		MaxAttempts: envInt("MAIL_MAX_ATTEMPTS", 8),
+		RetryBase:   time.Duration(envInt("MAIL_RETRY_BASE_SECONDS", 30)) * time.Second,
+		RetryMax:    time.Duration(envInt("MAIL_RETRY_MAX_SECONDS", 3600)) * time.Second,
+	}
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Ignoring %s=%q, it isn't a positive number", name, value)
+		return fallback
+	}
+
+	return n
+}
+
+// retryDelay returns how long to wait before trying a message again after its attempt-th failure
+func (q QueueConfig) retryDelay(attempt int) time.Duration {
+	delay := q.RetryBase
+	for i := 1; i < attempt && delay < q.RetryMax; i++ {
+		delay *= 2
+	}
+
+	if delay > q.RetryMax {
+		delay = q.RetryMax
+	}
+
+	return delay
+}
+
+// deliverMail sends the queued messages one at a time, for as long as the service runs
+func (app *Config) deliverMail() {
+	for {
+		job, err := app.Models.Job.Claim(jobLease)
+		if err != nil {
+			log.Printf("mail queue: can't claim a job: %s", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		if job == nil {
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		app.deliver(job)
+	}
+}
+
+// deliver makes one attempt at sending the message of job and records how it went
+func (app *Config) deliver(job *data.Job) {
+	err := app.Mailer.SendSMTPMessage(Message{
+		From:    job.From,
+		To:      job.To,
+		Subject: job.Subject,
+		Data:    job.Message,
+	})
+	if err == nil {
+		if err := app.Models.Job.MarkSent(job); err != nil {
+			// the lease runs out and the message is sent again, better twice than never
+			log.Printf("mail queue: can't mark job %d sent: %s", job.ID, err)
+		}
+		return
+	}
+
+	retryAt := time.Now().Add(app.Queue.retryDelay(job.Attempts))
+	if job.Attempts >= job.MaxAttempts {
+		log.Printf("mail queue: job %d to %s failed %d times, giving up: %s", job.ID, job.To, job.Attempts, err)
+	} else {
+		log.Printf("mail queue: job %d to %s failed, retrying at %s: %s", job.ID, job.To, retryAt.Format(time.RFC3339), err)
+	}
+
+	if err := app.Models.Job.MarkFailed(job, err.Error(), retryAt); err != nil {
+		log.Printf("mail queue: can't record the failure of job %d: %s", job.ID, err)
+	}
+}
+
+// collectSentJobs removes the delivered messages older than sentRetention
+func (app *Config) collectSentJobs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := app.Models.Job.DeleteSentBefore(time.Now().Add(-sentRetention))
+		if err != nil {
+			log.Printf("mail queue gc failed: %s", err)
+			continue
+		}
+
+		if removed > 0 {
+			log.Printf("mail queue gc: removed %d sent jobs", removed)
+		}
+	}
+}
@@ -15,7 +15,7 @@ func (app *Config) routes() http.Handler {
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-KEY"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -23,8 +23,17 @@ func (app *Config) routes() http.Handler {
 
 	mux.Use(middleware.Heartbeat("/heartbeat"))
 
-	mux.Post("/send", app.SendMail)
 	mux.Post("/verify", app.VerifyMail)
 
+	// only the services of the stack send mail, and only the administrators see the queue
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.requireAPIKey)
+
+		mux.Post("/send", app.SendMail)
+		mux.Get("/status/{id}", app.MailStatus)
+		mux.Get("/dead", app.DeadLetters)
+		mux.Post("/dead/{id}/retry", app.RetryMail)
+	})
+
 	return mux
 }
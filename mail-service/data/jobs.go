@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// the states of a mail job: queued until a worker claims it, sending while a worker has it,
+// then sent, or dead once it has failed too often
+const (
+	JobQueued  = "queued"
+	JobSending = "sending"
+	JobSent    = "sent"
+	JobDead    = "dead"
+)
+
+var ErrJobNotFound = errors.New("mail job not found")
+
+// ErrLeaseLost is returned when the attempt being recorded is no longer the current one,
+// the lease ran out and another worker claimed the job
+var ErrLeaseLost = errors.New("mail job claimed by another worker")
+
+// Job is a message waiting to be, or that was, delivered. NextAttemptAt is when a queued job
+// is tried again, and for a job being sent when its worker's claim on it runs out.
+type Job struct {
+	ID            int64      `json:"id"`
+	From          string     `json:"from"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Message       string     `json:"message,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"max_attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+const jobColumns = `id, sender, recipient, subject, message, status, attempts, max_attempts,
+	next_attempt_at, last_error, created_at, updated_at, sent_at`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var job Job
+	err := row.Scan(&job.ID, &job.From, &job.To, &job.Subject, &job.Message, &job.Status, &job.Attempts,
+		&job.MaxAttempts, &job.NextAttemptAt, &job.LastError, &job.CreatedAt, &job.UpdatedAt, &job.SentAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Enqueue stores a new job to be delivered as soon as a worker is free, and returns its id
+func (j *Job) Enqueue(job Job) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `insert into mail_jobs (sender, recipient, subject, message, status, attempts, max_attempts,
+		next_attempt_at, last_error, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, 0, $6, $7, '', $7, $7) returning id`
+
+	var id int64
+	err := db.QueryRowContext(ctx, stmt, job.From, job.To, job.Subject, job.Message, JobQueued,
+		job.MaxAttempts, now).Scan(&id)
+
+	return id, err
+}
+
+// GetOne returns the job with the given id
+func (j *Job) GetOne(id int64) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	job, err := scanJob(db.QueryRowContext(ctx, `select `+jobColumns+` from mail_jobs where id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+
+	return job, err
+}
+
+// Claim hands the next job that is due to a worker, for lease, and counts the attempt.
+// A job whose worker died is due again once its lease runs out, unless that was its last
+// attempt, then it goes to the dead letters. It returns nil when no job is due.
+func (j *Job) Claim(lease time.Duration) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `update mail_jobs set status = $1, last_error = $2, updated_at = $3
+	where status = $4 and attempts >= max_attempts and next_attempt_at <= $3`,
+		JobDead, "lease ran out on the last attempt", now, JobSending)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `update mail_jobs set status = $1, attempts = attempts + 1, next_attempt_at = $2, updated_at = $3
+	where id = (
+		select id from mail_jobs
+		where status in ($4, $1) and attempts < max_attempts and next_attempt_at <= $3
+		order by next_attempt_at
+		limit 1
+		for update skip locked
+	)
+	returning ` + jobColumns
+
+	job, err := scanJob(db.QueryRowContext(ctx, stmt, JobSending, now.Add(lease), now, JobQueued))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return job, err
+}
+
+// MarkSent records that the attempt of job was delivered. The message isn't kept, it can hold
+// links with live tokens.
+func (j *Job) MarkSent(job *Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update mail_jobs set status = $1, last_error = '', message = '', sent_at = $2, updated_at = $2
+	where id = $3 and status = $4 and attempts = $5`
+	result, err := db.ExecContext(ctx, stmt, JobSent, now, job.ID, JobSending, job.Attempts)
+
+	return checkAttempt(result, err)
+}
+
+// MarkFailed records why the attempt of job failed. It is queued again at retryAt,
+// or moved to the dead letters when it has used all its attempts.
+func (j *Job) MarkFailed(job *Job, reason string, retryAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	status := JobQueued
+	if job.Attempts >= job.MaxAttempts {
+		status = JobDead
+	}
+
+	stmt := `update mail_jobs set status = $1, last_error = $2, next_attempt_at = $3, updated_at = $4
+	where id = $5 and status = $6 and attempts = $7`
+	result, err := db.ExecContext(ctx, stmt, status, reason, retryAt, time.Now(), job.ID, JobSending, job.Attempts)
+
+	return checkAttempt(result, err)
+}
+
+// checkAttempt turns the update of an attempt that matched no job into ErrLeaseLost
+func checkAttempt(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// Dead returns the dead letters, the latest first, without their message, which can
+// hold links with live tokens
+func (j *Job) Dead() ([]*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `select `+jobColumns+` from mail_jobs where status = $1 order by updated_at desc`, JobDead)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		job.Message = ""
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Retry queues a dead letter again with a fresh set of attempts. It returns ErrJobNotFound
+// when there is no dead job with that id.
+func (j *Job) Retry(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update mail_jobs set status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+	where id = $3 and status = $4`
+	result, err := db.ExecContext(ctx, stmt, JobQueued, now, id, JobDead)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrJobNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DeleteSentBefore removes the jobs delivered before t and returns how many
+func (j *Job) DeleteSentBefore(t time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `delete from mail_jobs where status = $1 and sent_at < $2`, JobSent, t)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
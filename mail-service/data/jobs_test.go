@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queueDB stands in for Postgres in the tests of the queue. It keeps the statements the
+// queue runs and answers them with the job rows and the affected count the test set.
+type queueDB struct {
+	statements []queueStatement
+	rows       [][]driver.Value
+	affected   int64
+}
+
+type queueStatement struct {
+	query string
+	args  []driver.Value
+}
+
+func useTestDB(t *testing.T) *queueDB {
+	t.Helper()
+
+	fake := &queueDB{affected: 1}
+	conn := sql.OpenDB(fake)
+
+	db = conn
+	t.Cleanup(func() { conn.Close() })
+
+	return fake
+}
+
+// last returns the last statement the queue ran
+func (q *queueDB) last(t *testing.T) queueStatement {
+	t.Helper()
+
+	if len(q.statements) == 0 {
+		t.Fatal("no statement was run")
+	}
+	return q.statements[len(q.statements)-1]
+}
+
+func (q *queueDB) record(query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	q.statements = append(q.statements, queueStatement{query: query, args: values})
+}
+
+// the queue runs its statements directly, it doesn't prepare them or open transactions
+func (q *queueDB) Connect(context.Context) (driver.Conn, error) { return q, nil }
+func (q *queueDB) Driver() driver.Driver                        { return q }
+func (q *queueDB) Open(string) (driver.Conn, error)             { return q, nil }
+func (q *queueDB) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (q *queueDB) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+func (q *queueDB) Close() error                                 { return nil }
+
+func (q *queueDB) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	q.record(query, args)
+	return driver.RowsAffected(q.affected), nil
+}
+
+func (q *queueDB) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q.record(query, args)
+
+	rows := q.rows
+	q.rows = nil
+	return &jobRows{rows: rows}, nil
+}
+
+// jobRows answers with rows of jobColumns
+type jobRows struct {
+	rows [][]driver.Value
+}
+
+func (r *jobRows) Columns() []string {
+	return strings.Split(strings.Join(strings.Fields(jobColumns), ""), ",")
+}
+
+func (r *jobRows) Close() error { return nil }
+
+func (r *jobRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func jobRow(id int64, status string, attempts int64, nextAttemptAt time.Time) []driver.Value {
+	now := time.Now()
+	return []driver.Value{id, "admin@example.com", "user@example.com", "subject", "message", status,
+		attempts, int64(8), nextAttemptAt, "", now, now, nil}
+}
+
+func TestClaim(t *testing.T) {
+	fake := useTestDB(t)
+
+	lease := 2 * time.Minute
+	until := time.Now().Add(lease)
+	fake.rows = [][]driver.Value{jobRow(7, JobSending, 3, until)}
+
+	var j Job
+	before := time.Now()
+	job, err := j.Claim(lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job == nil || job.ID != 7 || job.Status != JobSending || job.Attempts != 3 {
+		t.Fatalf("Claim returned %+v", job)
+	}
+
+	claim := fake.last(t)
+	if !strings.Contains(claim.query, "for update skip locked") || !strings.Contains(claim.query, "attempts = attempts + 1") {
+		t.Errorf("Claim doesn't lock the job and count the attempt: %s", claim.query)
+	}
+	if !strings.Contains(claim.query, "attempts < max_attempts") {
+		t.Errorf("Claim hands out jobs that used all their attempts: %s", claim.query)
+	}
+
+	if claim.args[0] != JobSending || claim.args[3] != JobQueued {
+		t.Errorf("Claim moves %v jobs to %v, want %s to %s", claim.args[3], claim.args[0], JobQueued, JobSending)
+	}
+
+	leaseEnd, _ := claim.args[1].(time.Time)
+	claimedAt, _ := claim.args[2].(time.Time)
+	if got := leaseEnd.Sub(claimedAt); got != lease {
+		t.Errorf("Claim leases the job for %s, want %s", got, lease)
+	}
+	if claimedAt.Before(before) {
+		t.Errorf("Claim looks for jobs due at %s, before it was called", claimedAt)
+	}
+}
+
+func TestClaimBuriesLastAttempts(t *testing.T) {
+	fake := useTestDB(t)
+
+	var j Job
+	if _, err := j.Claim(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.statements) != 2 {
+		t.Fatalf("Claim ran %d statements, want 2", len(fake.statements))
+	}
+
+	bury := fake.statements[0]
+	if !strings.Contains(bury.query, "attempts >= max_attempts") {
+		t.Errorf("Claim doesn't look for the jobs out of attempts: %s", bury.query)
+	}
+	if bury.args[0] != JobDead || bury.args[3] != JobSending {
+		t.Errorf("Claim moves %v jobs to %v, want %s to %s", bury.args[3], bury.args[0], JobSending, JobDead)
+	}
+}
+
+func TestClaimNothingDue(t *testing.T) {
+	useTestDB(t)
+
+	var j Job
+	job, err := j.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job != nil {
+		t.Fatalf("Claim returned %+v with no job due", job)
+	}
+}
+
+func TestMarkSent(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected int64
+		wantErr  error
+	}{
+		{"current attempt", 1, nil},
+		{"claimed by another worker", 0, ErrLeaseLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useTestDB(t)
+			fake.affected = tt.affected
+
+			var j Job
+			err := j.MarkSent(&Job{ID: 7, Attempts: 3})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MarkSent returned %v, want %v", err, tt.wantErr)
+			}
+
+			mark := fake.last(t)
+			if !strings.Contains(mark.query, "message = ''") {
+				t.Errorf("MarkSent keeps the message: %s", mark.query)
+			}
+			if !strings.Contains(mark.query, "status = $4 and attempts = $5") {
+				t.Errorf("MarkSent doesn't check the attempt: %s", mark.query)
+			}
+			if mark.args[2] != int64(7) || mark.args[3] != JobSending || mark.args[4] != int64(3) {
+				t.Errorf("MarkSent checks %v, want job 7 sending its 3rd attempt", mark.args[2:])
+			}
+		})
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		affected   int64
+		wantStatus string
+		wantErr    error
+	}{
+		{"attempts left", 3, 1, JobQueued, nil},
+		{"last attempt", 8, 1, JobDead, nil},
+		{"claimed by another worker", 3, 0, JobQueued, ErrLeaseLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useTestDB(t)
+			fake.affected = tt.affected
+
+			var j Job
+			err := j.MarkFailed(&Job{ID: 7, Attempts: tt.attempts, MaxAttempts: 8}, "smtp down", time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MarkFailed returned %v, want %v", err, tt.wantErr)
+			}
+
+			mark := fake.last(t)
+			if mark.args[0] != tt.wantStatus {
+				t.Errorf("MarkFailed moved the job to %v, want %s", mark.args[0], tt.wantStatus)
+			}
+			if !strings.Contains(mark.query, "status = $6 and attempts = $7") {
+				t.Errorf("MarkFailed doesn't check the attempt: %s", mark.query)
+			}
+			if mark.args[5] != JobSending || mark.args[6] != int64(tt.attempts) {
+				t.Errorf("MarkFailed checks %v, want sending attempt %d", mark.args[5:], tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+var db *sql.DB
+
+// New is the function used to create an instance of the data package. It returns the type
+// Models, which embeds all the types we want to be available to our application.
+func New(dbPool *sql.DB) Models {
+	db = dbPool
+
+	return Models{
+		Job: Job{},
+	}
+}
+
+// Models is the type for this package
+type Models struct {
+	Job Job
+}